@@ -21,6 +21,12 @@ type AuthClient interface {
 	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
 	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
 	IsAdmin(ctx context.Context, in *IsAdminRequest, opts ...grpc.CallOption) (*IsAdminResponse, error)
+	// Streams session events as they happen, until the client disconnects.
+	// Callers authenticate with a bearer token in the "authorization"
+	// metadata and may only watch their own sessions, unless they are admins.
+	// A client falling too far behind gets ABORTED and should resync and
+	// watch again.
+	WatchSessions(ctx context.Context, in *WatchSessionsRequest, opts ...grpc.CallOption) (Auth_WatchSessionsClient, error)
 }
 
 type authClient struct {
@@ -58,6 +64,38 @@ func (c *authClient) IsAdmin(ctx context.Context, in *IsAdminRequest, opts ...gr
 	return out, nil
 }
 
+func (c *authClient) WatchSessions(ctx context.Context, in *WatchSessionsRequest, opts ...grpc.CallOption) (Auth_WatchSessionsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Auth_ServiceDesc.Streams[0], "/auth.Auth/WatchSessions", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &authWatchSessionsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Auth_WatchSessionsClient interface {
+	Recv() (*SessionEvent, error)
+	grpc.ClientStream
+}
+
+type authWatchSessionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *authWatchSessionsClient) Recv() (*SessionEvent, error) {
+	m := new(SessionEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // AuthServer is the server API for Auth service.
 // All implementations must embed UnimplementedAuthServer
 // for forward compatibility
@@ -65,6 +103,12 @@ type AuthServer interface {
 	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
 	Login(context.Context, *LoginRequest) (*LoginResponse, error)
 	IsAdmin(context.Context, *IsAdminRequest) (*IsAdminResponse, error)
+	// Streams session events as they happen, until the client disconnects.
+	// Callers authenticate with a bearer token in the "authorization"
+	// metadata and may only watch their own sessions, unless they are admins.
+	// A client falling too far behind gets ABORTED and should resync and
+	// watch again.
+	WatchSessions(*WatchSessionsRequest, Auth_WatchSessionsServer) error
 	mustEmbedUnimplementedAuthServer()
 }
 
@@ -81,6 +125,9 @@ func (UnimplementedAuthServer) Login(context.Context, *LoginRequest) (*LoginResp
 func (UnimplementedAuthServer) IsAdmin(context.Context, *IsAdminRequest) (*IsAdminResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method IsAdmin not implemented")
 }
+func (UnimplementedAuthServer) WatchSessions(*WatchSessionsRequest, Auth_WatchSessionsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSessions not implemented")
+}
 func (UnimplementedAuthServer) mustEmbedUnimplementedAuthServer() {}
 
 // UnsafeAuthServer may be embedded to opt out of forward compatibility for this service.
@@ -148,6 +195,27 @@ func _Auth_IsAdmin_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Auth_WatchSessions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchSessionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AuthServer).WatchSessions(m, &authWatchSessionsServer{stream})
+}
+
+type Auth_WatchSessionsServer interface {
+	Send(*SessionEvent) error
+	grpc.ServerStream
+}
+
+type authWatchSessionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *authWatchSessionsServer) Send(m *SessionEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Auth_ServiceDesc is the grpc.ServiceDesc for Auth service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -168,6 +236,12 @@ var Auth_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _Auth_IsAdmin_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchSessions",
+			Handler:       _Auth_WatchSessions_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "sso/sso.proto",
 }
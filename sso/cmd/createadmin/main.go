@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sso/internal/app"
+	"sso/internal/config"
+	"sso/internal/domain/models"
+	"sso/internal/services/auth"
+	"sso/internal/storage"
+	"sso/internal/storage/postgres"
+	"sso/internal/storage/sqlite"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func main() {
+	var driver, storagePath, email, password string
+	var bcryptCost int
+	var force bool
+
+	flag.StringVar(&driver, "driver", config.StorageDriverSQLite, "database driver: sqlite3 or postgres")
+	flag.StringVar(&storagePath, "storage-path", "", "path to the storage (SQLite file or PostgreSQL connection URL)")
+	flag.StringVar(&email, "email", "", "email of the admin user")
+	flag.StringVar(&password, "password", "", "password of the admin user")
+	flag.IntVar(&bcryptCost, "bcrypt-cost", bcrypt.DefaultCost, "bcrypt cost of the password hash")
+	flag.BoolVar(&force, "force", false, "if the email is taken, reset that user's password and make them an admin")
+
+	flag.Parse()
+
+	if storagePath == "" {
+		panic("storage path is empty")
+	}
+
+	if email == "" {
+		panic("email is empty")
+	}
+
+	if password == "" {
+		panic("password is empty")
+	}
+
+	s, err := openStorage(driver, storagePath)
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	authService, err := auth.NewWithOptions(auth.Config{
+		Log:          slog.New(slog.DiscardHandler),
+		UserSaver:    s,
+		UserProvider: s,
+		AppProvider:  s,
+		AppSaver:     s,
+		RefreshStore: s,
+		TokenRevoker: s,
+		ResetStore:   s,
+		Attempts:     s,
+		TOTPStore:    s,
+		Roles:        s,
+		VerifyStore:  s,
+		AuditLog:     s,
+		Sessions:     s,
+		TokenTTL:     time.Hour,
+		ResetTTL:     time.Minute,
+		VerifyTTL:    time.Minute,
+		StrictEmails: true,
+		BcryptCost:   bcryptCost,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.Background()
+
+	userID, err := authService.RegisterNewUser(ctx, email, password)
+	switch {
+	case errors.Is(err, auth.ErrUserExists) && force:
+		userID, err = resetPassword(ctx, authService, s, email, password)
+		if err != nil {
+			panic(err)
+		}
+	case errors.Is(err, auth.ErrUserExists):
+		panic(fmt.Sprintf("user %s already exists, pass -force to make them an admin", email))
+	case err != nil:
+		panic(err)
+	}
+
+	if err := authService.AssignRole(ctx, userID, models.RoleAdmin); err != nil {
+		panic(err)
+	}
+
+	// The admin set their own email, so it doesn't need verifying.
+	token, err := authService.RequestEmailVerification(ctx, userID)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := authService.VerifyEmail(ctx, token); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("admin %s has user id %d\n", email, userID)
+}
+
+func openStorage(driver, storagePath string) (app.Storage, error) {
+	switch driver {
+	case config.StorageDriverSQLite:
+		return sqlite.New(storagePath, storage.PoolConfig{}, sqlite.Options{BusyTimeout: 5 * time.Second}, storage.RetryPolicy{})
+	case config.StorageDriverPostgres:
+		return postgres.New(storagePath, storage.PoolConfig{}, storage.RetryPolicy{})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// resetPassword sets the password of the existing user with the given email
+// through a password reset and returns the user's ID.
+func resetPassword(ctx context.Context, authService *auth.Auth, userProvider auth.UserProvider, email, password string) (int64, error) {
+	// Emails are stored trimmed and lowercased.
+	user, err := userProvider.User(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return 0, fmt.Errorf("user %s is deleted", email)
+		}
+
+		return 0, err
+	}
+
+	token, err := authService.RequestPasswordReset(ctx, user.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := authService.ResetPassword(ctx, token, password); err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
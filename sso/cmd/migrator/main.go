@@ -4,18 +4,33 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"sso/internal/migrator"
+	"sso/internal/storage/sqlite"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source"
 )
 
 func main() {
-	var storagePath, migrationsPath, migrationsTable string
+	var driver, storagePath, migrationsPath, migrationsTable, direction string
+	var steps, forceVersion int
+	var showVersion, dryRun bool
+	var sqliteOpts sqlite.Options
 
-	flag.StringVar(&storagePath, "storage-path", "", "path to the storage")
+	flag.StringVar(&driver, "driver", migrator.DriverSQLite, "database driver: sqlite3 or postgres")
+	flag.StringVar(&storagePath, "storage-path", "", "path to the storage (SQLite file or PostgreSQL connection URL)")
 	flag.StringVar(&migrationsPath, "migrations-path", "", "path to the migrations")
 	flag.StringVar(&migrationsTable, "migrations-table", "", "name of the migrations table")
+	flag.StringVar(&direction, "direction", string(migrator.Up), "migration direction: up or down")
+	flag.IntVar(&steps, "steps", 0, "number of migrations to apply or roll back, 0 means all")
+	flag.IntVar(&forceVersion, "force", -1, "mark the schema as clean at the given version without running any SQL")
+	flag.BoolVar(&showVersion, "version", false, "print the current schema version and dirty status and exit")
+	flag.BoolVar(&dryRun, "dry-run", false, "print the migrations that would run without applying them")
+	flag.DurationVar(&sqliteOpts.BusyTimeout, "sqlite-busy-timeout", 5*time.Second, "how long to wait for a SQLite database locked by the service")
+	flag.StringVar(&sqliteOpts.JournalMode, "sqlite-journal-mode", "WAL", "SQLite journal mode, which should match the service's")
 
 	flag.Parse()
 
@@ -27,14 +42,58 @@ func main() {
 		panic("migrations path is empty")
 	}
 
-	m, err := migrate.New("file://"+migrationsPath, fmt.Sprintf("sqlite3://%s?x-migrations-table=%s", storagePath, migrationsTable))
+	if direction != string(migrator.Up) && direction != string(migrator.Down) {
+		panic("direction must be up or down")
+	}
+
+	if steps < 0 {
+		panic("steps must not be negative")
+	}
+
+	m, err := migrator.New(driver, storagePath, migrationsPath, migrationsTable, sqliteOpts)
 	if err != nil {
 		panic(err)
 	}
 
-	if err := m.Up(); err != nil {
+	if showVersion {
+		printVersion(m)
+
+		return
+	}
+
+	if dryRun {
+		if err := printPending(m, "file://"+migrationsPath, migrator.Direction(direction), steps); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	// Force only rewrites the version bookkeeping row to recover from a failed
+	// migration; the schema itself must be fixed by hand beforehand.
+	if forceVersion >= 0 {
+		if err := m.Force(forceVersion); err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("forced schema version %d\n", forceVersion)
+		printVersion(m)
+
+		return
+	}
+
+	if err := migrator.Run(m, migrator.Direction(direction), steps); err != nil {
+		var shortLimit migrate.ErrShortLimit
+		if errors.As(err, &shortLimit) {
+			fmt.Printf("migrations applied successfully, %d fewer than requested were available\n", shortLimit.Short)
+			printVersion(m)
+
+			return
+		}
+
 		if errors.Is(err, migrate.ErrNoChange) {
 			fmt.Println("no migrations to apply")
+			printVersion(m)
 
 			return
 		}
@@ -43,4 +102,157 @@ func main() {
 	}
 
 	fmt.Println("migrations applied successfully")
+	printVersion(m)
+}
+
+// printPending prints the migrations migrator.Run would apply in the given
+// direction, from the current schema version towards the latest (or first)
+// version available in the source.
+func printPending(m *migrate.Migrate, sourceURL string, direction migrator.Direction, steps int) error {
+	src, err := source.Open(sourceURL)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	current, dirty, err := m.Version()
+	hasVersion := true
+	if errors.Is(err, migrate.ErrNilVersion) {
+		hasVersion = false
+	} else if err != nil {
+		return err
+	}
+
+	if dirty {
+		fmt.Printf("schema version %d is dirty, fix it and use -force before migrating\n", current)
+	}
+
+	var versions []uint
+	if direction == migrator.Down {
+		versions, err = versionsDown(src, current, hasVersion)
+	} else {
+		versions, err = versionsUp(src, current, hasVersion)
+	}
+	if err != nil {
+		return err
+	}
+
+	if steps > 0 && len(versions) > steps {
+		versions = versions[:steps]
+	}
+
+	printVersion(m)
+
+	if len(versions) == 0 {
+		fmt.Println("no migrations to apply")
+
+		return nil
+	}
+
+	fmt.Printf("%d migrations would be applied:\n", len(versions))
+
+	for _, version := range versions {
+		name, err := migrationFileName(src, version, direction)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("  %d %s\n", version, name)
+	}
+
+	return nil
+}
+
+// versionsUp returns the source versions after current in ascending order,
+// or all of them if the schema has no version yet.
+func versionsUp(src source.Driver, current uint, hasVersion bool) ([]uint, error) {
+	var (
+		version uint
+		err     error
+	)
+
+	if hasVersion {
+		version, err = src.Next(current)
+	} else {
+		version, err = src.First()
+	}
+
+	var versions []uint
+
+	for err == nil {
+		versions = append(versions, version)
+		version, err = src.Next(version)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// versionsDown returns current and the source versions before it in
+// descending order.
+func versionsDown(src source.Driver, current uint, hasVersion bool) ([]uint, error) {
+	if !hasVersion {
+		return nil, nil
+	}
+
+	versions := []uint{current}
+
+	version, err := src.Prev(current)
+	for err == nil {
+		versions = append(versions, version)
+		version, err = src.Prev(version)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// migrationFileName returns the file name of the migration for version in
+// the given direction. Versions without such a file only change the schema
+// version.
+func migrationFileName(src source.Driver, version uint, direction migrator.Direction) (string, error) {
+	var (
+		r          io.ReadCloser
+		identifier string
+		err        error
+	)
+
+	if direction == migrator.Down {
+		r, identifier, err = src.ReadDown(version)
+	} else {
+		r, identifier, err = src.ReadUp(version)
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Sprintf("(no %s migration)", direction), nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	_ = r.Close()
+
+	return fmt.Sprintf("%d_%s.%s.sql", version, identifier, direction), nil
+}
+
+func printVersion(m *migrate.Migrate) {
+	version, dirty, err := m.Version()
+	if err != nil {
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Println("schema version: none")
+
+			return
+		}
+
+		panic(err)
+	}
+
+	fmt.Printf("schema version: %d (dirty: %t)\n", version, dirty)
 }
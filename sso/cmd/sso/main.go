@@ -1,12 +1,15 @@
 package main
 
 import (
+	"flag"
 	"io"
 	"log/slog"
 	"os"
 	"os/signal"
 	"sso/internal/app"
 	"sso/internal/config"
+	"sso/internal/migrator"
+	"sso/internal/storage/sqlite"
 	"syscall"
 )
 
@@ -16,16 +19,33 @@ const (
 	envProd  = "prod"
 )
 
+// The flags are parsed by config.MustLoad along with -config.
+var (
+	autoMigrate     = flag.Bool("auto-migrate", false, "apply pending migrations before starting")
+	migrationsPath  = flag.String("migrations-path", "", "path to the migrations, ./migrations or ./migrations/postgres depending on the storage driver by default")
+	migrationsTable = flag.String("migrations-table", "", "name of the migrations table")
+)
+
 func main() {
 	cfg := config.MustLoad()
 	log := setupLogger(cfg.Env)
 
 	log.Info("starting application", slog.Any("config", cfg))
 
-	application := app.New(log, cfg.Grpc.Port, cfg.StoragePath, cfg.TokenTTL)
+	if *autoMigrate {
+		if err := runMigrations(log, cfg); err != nil {
+			panic(err)
+		}
+	}
+
+	application := app.New(log, cfg)
 
 	go application.GRPCSrv.MustRun()
 
+	if application.HTTPSrv != nil {
+		go application.HTTPSrv.MustRun()
+	}
+
 	stop := make(chan os.Signal, 1)
 
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
@@ -34,11 +54,34 @@ func main() {
 
 	log.Info("stopping application", slog.String("signal", sign.String()))
 
-	application.GRPCSrv.Stop()
+	application.Stop()
 
 	log.Info("application stopped")
 }
 
+// runMigrations applies the pending migrations of the configured storage.
+func runMigrations(log *slog.Logger, cfg *config.Config) error {
+	path := *migrationsPath
+	if path == "" {
+		path = "./migrations"
+		if cfg.StorageDriver == config.StorageDriverPostgres {
+			path = "./migrations/postgres"
+		}
+	}
+
+	log.Info("applying migrations", slog.String("migrations_path", path))
+
+	sqliteOpts := sqlite.Options{BusyTimeout: cfg.SQLiteBusyTimeout, JournalMode: cfg.SQLiteJournalMode}
+
+	if err := migrator.RunMigrations(cfg.StorageDriver, cfg.StoragePath, path, *migrationsTable, sqliteOpts, migrator.Up); err != nil {
+		return err
+	}
+
+	log.Info("migrations applied")
+
+	return nil
+}
+
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 
@@ -0,0 +1,7 @@
+//go:build postgres
+
+// PostgreSQL support pulls in the lib/pq driver, so it is only compiled into
+// the service when building with -tags postgres.
+package main
+
+import _ "github.com/lib/pq"
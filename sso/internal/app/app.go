@@ -1,23 +1,338 @@
 package app
 
 import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	grpcapp "sso/internal/app/grpc"
+	httpapp "sso/internal/app/http"
+	"sso/internal/config"
+	authrpc "sso/internal/grpc/auth"
+	"sso/internal/grpc/health"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/passhash"
+	"sso/internal/lib/ratelimit"
+	"sso/internal/lib/secretbox"
+	"sso/internal/lib/webhook"
+	"sso/internal/services/auth"
+	"sso/internal/storage"
+	"sso/internal/storage/postgres"
+	"sso/internal/storage/sqlite"
+	"sync"
 	"time"
 )
 
 type App struct {
 	GRPCSrv *grpcapp.App
+	// HTTPSrv serves the JWKS and metrics endpoints. It is nil when no HTTP port
+	// is configured.
+	HTTPSrv *httpapp.App
+
+	log             *slog.Logger
+	storage         Storage
+	shutdownTracing func(context.Context) error
+
+	// stopBackground stops the background jobs, which background waits
+	// for.
+	stopBackground context.CancelFunc
+	background     sync.WaitGroup
+}
+
+// Storage is implemented by every storage backend the service can run on.
+type Storage interface {
+	auth.UserSaver
+	auth.UserProvider
+	auth.AppProvider
+	auth.AppSaver
+	auth.RefreshTokenStorage
+	auth.TokenRevoker
+	auth.PasswordResetStorage
+	auth.LoginAttemptsStorage
+	auth.TOTPStorage
+	auth.RoleStorage
+	auth.EmailVerificationStorage
+	auth.AuditLogStorage
+	auth.SessionStorage
+	auth.MagicLinkStorage
+	auth.OutboxStorage
+	health.Pinger
+	io.Closer
+	LogSlowQueries(log *slog.Logger, threshold time.Duration)
+	SetQueryTimeout(timeout time.Duration)
+}
+
+func New(log *slog.Logger, cfg *config.Config) *App {
+	storage, err := newStorage(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	storage.SetQueryTimeout(cfg.StorageQueryTimeout)
+	storage.LogSlowQueries(log, cfg.SlowQueryThreshold)
+
+	totpKey, err := decodeTOTPKey(cfg.TOTPEncryptionKey)
+	if err != nil {
+		panic(err)
+	}
+
+	keys, err := loadKeys(cfg.JWT, max(cfg.TokenTTL, cfg.MaxAppTokenTTL))
+	if err != nil {
+		panic(err)
+	}
+
+	var (
+		tracer          auth.Tracer
+		shutdownTracing func(context.Context) error
+	)
+
+	if cfg.Tracing.Enabled {
+		if newTracer == nil {
+			panic("tracing is enabled but the service was built without -tags otel")
+		}
+
+		tracer, shutdownTracing, err = newTracer(cfg.Tracing)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	hasher, err := newPasswordHasher(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	var userProvider auth.UserProvider = storage
+	if cfg.AdminCache.TTL > 0 {
+		userProvider = auth.NewAdminCache(storage, cfg.AdminCache.TTL, max(cfg.AdminCache.Size, 1))
+	}
+
+	var appProvider auth.AppProvider = storage
+	if cfg.AppCache.TTL > 0 {
+		appProvider = auth.NewAppCache(storage, cfg.AppCache.TTL, max(cfg.AppCache.Size, 1))
+	}
+
+	authService, err := auth.NewWithOptions(auth.Config{
+		Log:                      log,
+		UserSaver:                storage,
+		UserProvider:             userProvider,
+		AppProvider:              appProvider,
+		AppSaver:                 storage,
+		RefreshStore:             storage,
+		TokenRevoker:             storage,
+		ResetStore:               storage,
+		Attempts:                 storage,
+		TOTPStore:                storage,
+		Roles:                    storage,
+		VerifyStore:              storage,
+		AuditLog:                 storage,
+		Sessions:                 storage,
+		MagicLinks:               storage,
+		Outbox:                   outboxStorage(cfg.Outbox, storage),
+		Keys:                     keys,
+		Issuer:                   cfg.JWT.Issuer,
+		Leeway:                   cfg.JWT.Leeway,
+		TokenTTL:                 cfg.TokenTTL,
+		MaxAppTokenTTL:           cfg.MaxAppTokenTTL,
+		RefreshTTL:               cfg.RefreshTTL,
+		RememberMeTTL:            cfg.RememberMeTTL,
+		ResetTTL:                 cfg.PasswordResetTTL,
+		VerifyTTL:                cfg.EmailVerificationTTL,
+		MagicLinkTTL:             cfg.MagicLinkTTL,
+		VerifyResendCooldown:     cfg.VerifyResendCooldown,
+		OutboxPollInterval:       cfg.Outbox.PollInterval,
+		RevokeOnPasswordChange:   cfg.RevokeOnPasswordChange,
+		MaxLoginAttempts:         cfg.MaxLoginAttempts,
+		LockoutDuration:          cfg.LockoutDuration,
+		MinLoginDuration:         cfg.MinLoginDuration,
+		TOTPKey:                  totpKey,
+		RequireEmailVerification: cfg.RequireEmailVerification,
+		DefaultRoles:             cfg.DefaultRoles,
+		BootstrapFirstAdmin:      cfg.BootstrapFirstAdmin,
+		TemporaryAdminPasswords:  cfg.TemporaryAdminPasswords,
+		PasswordPolicy:           auth.PasswordPolicy(cfg.PasswordPolicy),
+		StrictEmails:             cfg.StrictEmailValidation,
+		BcryptCost:               cfg.BcryptCost,
+		Hasher:                   hasher,
+		Limiter:                  newLoginRateLimiter(cfg.LoginRateLimit),
+		LoginNotifier:            newLoginNotifier(cfg.LoginWebhook),
+		Clock:                    jwt.RealClock,
+		Tracer:                   tracer,
+		RedactEmails:             cfg.RedactEmails,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	a := &App{
+		log:             log,
+		storage:         storage,
+		shutdownTracing: shutdownTracing,
+	}
+
+	var backgroundCtx context.Context
+	backgroundCtx, a.stopBackground = context.WithCancel(context.Background())
+
+	a.background.Go(func() { authService.RunRevokedTokensCleanup(backgroundCtx, cfg.CleanupInterval) })
+
+	if cfg.Outbox.URL != "" {
+		publisher := &webhook.OutboxPublisher{URL: cfg.Outbox.URL, Timeout: cfg.Outbox.Timeout}
+
+		a.background.Go(func() { authService.RunOutboxPublisher(backgroundCtx, publisher) })
+	}
+
+	var (
+		rpcAuth        authrpc.Auth = authService
+		metricsHandler http.Handler
+	)
+
+	if cfg.Metrics.Enabled {
+		if instrument == nil {
+			panic("metrics are enabled but the service was built without -tags prometheus")
+		}
+
+		rpcAuth, metricsHandler, err = instrument(authService)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	a.GRPCSrv = grpcapp.New(log, rpcAuth, storage, cfg.Grpc.Port, cfg.Grpc.Reflection)
+
+	if cfg.HTTP.Port != 0 {
+		a.HTTPSrv = httpapp.New(log, keys, metricsHandler, cfg.HTTP.Port)
+	}
+
+	return a
+}
+
+// Stop gracefully stops the servers and background jobs, then closes the
+// storage.
+func (a *App) Stop() {
+	a.GRPCSrv.Stop()
+
+	if a.HTTPSrv != nil {
+		a.HTTPSrv.Stop()
+	}
+
+	a.stopBackground()
+	a.background.Wait()
+
+	if a.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = a.shutdownTracing(ctx)
+	}
+
+	if err := a.storage.Close(); err != nil {
+		a.log.Error("failed to close storage", slog.String("error", err.Error()))
+	}
+}
+
+func newStorage(cfg *config.Config) (Storage, error) {
+	pool := storage.PoolConfig(cfg.StoragePool)
+	retry := storage.RetryPolicy(cfg.StorageRetry)
+
+	switch cfg.StorageDriver {
+	case config.StorageDriverSQLite:
+		opts := sqlite.Options{BusyTimeout: cfg.SQLiteBusyTimeout, JournalMode: cfg.SQLiteJournalMode}
+
+		return sqlite.New(cfg.StoragePath, pool, opts, retry)
+	case config.StorageDriverPostgres:
+		return postgres.New(cfg.StoragePath, pool, retry)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
+}
+
+// decodeTOTPKey decodes the hex-encoded TOTP encryption key. An empty key
+// leaves two-factor authentication unavailable.
+func decodeTOTPKey(key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	decoded, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid totp encryption key: %w", err)
+	}
+
+	if len(decoded) != secretbox.KeySize {
+		return nil, fmt.Errorf("invalid totp encryption key: must be %d bytes", secretbox.KeySize)
+	}
+
+	return decoded, nil
+}
+
+// loadKeys loads the RS256 signing keys. Without a configured signing key,
+// tokens are signed with HS256 using the app secrets. Retired keys stay valid
+// for maxTokenTTL, the longest TTL a token may be issued with, after their
+// rotation time, until the last token they signed has expired.
+func loadKeys(cfg config.JWTConfig, maxTokenTTL time.Duration) (jwt.KeyProvider, error) {
+	if cfg.SigningKeyID == "" {
+		return nil, nil
+	}
+
+	keys, err := jwt.LoadKeySet(cfg.SigningKeyID, cfg.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jwt keys: %w", err)
+	}
+
+	for kid, rotatedAt := range cfg.Retired {
+		if err := keys.RetireKey(kid, rotatedAt.Add(maxTokenTTL)); err != nil {
+			return nil, fmt.Errorf("failed to retire jwt key: %w", err)
+		}
+	}
+
+	return keys, nil
 }
 
-func New(log *slog.Logger, grpcPort int, storagePath string, tokenTTL time.Duration) *App {
-	// TODO: init storage
+// newPasswordHasher returns the hasher for new password hashes.
+func newPasswordHasher(cfg *config.Config) (auth.PasswordHasher, error) {
+	switch cfg.PasswordHash.Algorithm {
+	case passhash.AlgorithmBcrypt:
+		return passhash.Bcrypt{Cost: cfg.BcryptCost}, nil
+	case passhash.AlgorithmArgon2id:
+		return passhash.Argon2id(cfg.PasswordHash.Argon2id), nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.PasswordHash.Algorithm)
+	}
+}
+
+// newLoginRateLimiter returns the login rate limiter, or nil if rate limiting
+// is disabled.
+func newLoginRateLimiter(cfg config.RateLimitConfig) auth.RateLimiter {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+
+	return ratelimit.NewTokenBucket(cfg.Rate, max(cfg.Burst, 1))
+}
 
-	// TODO: init auth service
+// outboxStorage returns the storage of outbox events, none if they aren't
+// published anywhere, so that they don't pile up.
+func outboxStorage(cfg config.OutboxConfig, storage Storage) auth.OutboxStorage {
+	if cfg.URL == "" {
+		return nil
+	}
 
-	grpcApp := grpcapp.New(log, grpcPort)
+	return storage
+}
+
+// newLoginNotifier returns the login notification webhook, or nil if no URL
+// is configured.
+func newLoginNotifier(cfg config.LoginWebhookConfig) auth.LoginNotifier {
+	if cfg.URL == "" && len(cfg.AppURLs) == 0 {
+		return nil
+	}
 
-	return &App{
-		GRPCSrv: grpcApp,
+	return &webhook.LoginNotifier{
+		URL:         cfg.URL,
+		AppURLs:     cfg.AppURLs,
+		Timeout:     cfg.Timeout,
+		MaxAttempts: cfg.MaxAttempts,
 	}
 }
@@ -5,8 +5,10 @@ import (
 	"log/slog"
 	"net"
 	authrpc "sso/internal/grpc/auth"
+	"sso/internal/grpc/health"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 )
 
 type App struct {
@@ -15,10 +17,20 @@ type App struct {
 	port       int
 }
 
-func New(log *slog.Logger, port int) *App {
-	gRPCServer := grpc.NewServer()
+// New returns a gRPC server exposing the auth and health services, and server
+// reflection if enableReflection is set.
+func New(log *slog.Logger, authService authrpc.Auth, pinger health.Pinger, port int, enableReflection bool) *App {
+	gRPCServer := grpc.NewServer(
+		grpc.UnaryInterceptor(authrpc.MetaInterceptor()),
+		grpc.StreamInterceptor(authrpc.MetaStreamInterceptor()),
+	)
 
-	authrpc.Register(gRPCServer)
+	authrpc.Register(gRPCServer, authService)
+	health.Register(gRPCServer, log, pinger)
+
+	if enableReflection {
+		reflection.Register(gRPCServer)
+	}
 
 	return &App{
 		log:        log,
@@ -0,0 +1,82 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sso/internal/http/jwks"
+	"sso/internal/lib/jwt"
+	"time"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+// New returns the HTTP server exposing the JWKS endpoint and, if metrics is
+// non-nil, the /metrics endpoint.
+func New(log *slog.Logger, keys jwt.KeyProvider, metrics http.Handler, port int) *App {
+	mux := http.NewServeMux()
+
+	jwks.Register(mux, log, keys)
+
+	if metrics != nil {
+		mux.Handle("GET /metrics", metrics)
+	}
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		port: port,
+	}
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	log := a.log.With(slog.String("op", op), slog.Int("port", a.port))
+
+	log.Info("starting HTTP server")
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("HTTP server is running", slog.String("addr", l.Addr().String()))
+
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "httpapp.Stop"
+
+	a.log.With(slog.String("op", op)).Info("stopping HTTP server", slog.Int("port", a.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.log.With(slog.String("op", op)).Error("failed to stop HTTP server", slog.String("error", err.Error()))
+	}
+}
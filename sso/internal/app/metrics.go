@@ -0,0 +1,12 @@
+package app
+
+import (
+	"net/http"
+	authrpc "sso/internal/grpc/auth"
+	"sso/internal/services/auth"
+)
+
+// instrument wraps the auth service with metrics and returns the handler
+// serving them. It is nil unless the service is built with -tags prometheus,
+// see metrics_prometheus.go.
+var instrument func(a *auth.Auth) (authrpc.Auth, http.Handler, error)
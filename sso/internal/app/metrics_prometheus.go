@@ -0,0 +1,23 @@
+//go:build prometheus
+
+package app
+
+import (
+	"net/http"
+	authrpc "sso/internal/grpc/auth"
+	"sso/internal/services/auth"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func init() {
+	instrument = func(a *auth.Auth) (authrpc.Auth, http.Handler, error) {
+		instrumented, err := auth.NewInstrumentedAuth(a, prometheus.DefaultRegisterer)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return instrumented, promhttp.Handler(), nil
+	}
+}
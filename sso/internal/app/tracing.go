@@ -0,0 +1,12 @@
+package app
+
+import (
+	"context"
+	"sso/internal/config"
+	"sso/internal/services/auth"
+)
+
+// newTracer sets up trace export and returns the tracer for the auth service
+// along with a function flushing and stopping the exporter. It is nil unless
+// the service is built with -tags otel, see tracing_otel.go.
+var newTracer func(cfg config.TracingConfig) (auth.Tracer, func(context.Context) error, error)
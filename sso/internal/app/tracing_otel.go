@@ -0,0 +1,38 @@
+//go:build otel
+
+package app
+
+import (
+	"context"
+	"sso/internal/config"
+	"sso/internal/services/auth"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func init() {
+	newTracer = func(cfg config.TracingConfig) (auth.Tracer, func(context.Context) error, error) {
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		exporter, err := otlptracegrpc.New(context.Background(), opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		)
+
+		otel.SetTracerProvider(provider)
+
+		return auth.NewOTelTracer(provider.Tracer("sso/internal/services/auth")), provider.Shutdown, nil
+	}
+}
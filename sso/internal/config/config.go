@@ -2,22 +2,237 @@ package config
 
 import (
 	"flag"
+	"log/slog"
+	"net/url"
 	"os"
+	"regexp"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+const (
+	StorageDriverSQLite   = "sqlite3"
+	StorageDriverPostgres = "postgres"
+)
+
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path" env-required:"true"`
-	TokenTTL    time.Duration `yaml:"token_ttl" env:"TOKEN_TTL " env-default:"1h"`
-	Grpc        GRPCConfig    `yaml:"grpc"`
+	Env                      string               `yaml:"env" env-default:"local"`
+	StoragePath              string               `yaml:"storage_path" env-required:"true"`
+	StorageDriver            string               `yaml:"storage_driver" env:"STORAGE_DRIVER" env-default:"sqlite3"`
+	StoragePool              StoragePoolConfig    `yaml:"storage_pool"`
+	StorageRetry             StorageRetryConfig   `yaml:"storage_retry"`
+	SlowQueryThreshold       time.Duration        `yaml:"slow_query_threshold" env:"SLOW_QUERY_THRESHOLD" env-default:"0s"`
+	StorageQueryTimeout      time.Duration        `yaml:"storage_query_timeout" env:"STORAGE_QUERY_TIMEOUT" env-default:"10s"`
+	SQLiteBusyTimeout        time.Duration        `yaml:"sqlite_busy_timeout" env-default:"5s"`
+	SQLiteJournalMode        string               `yaml:"sqlite_journal_mode" env-default:"WAL"`
+	TokenTTL                 time.Duration        `yaml:"token_ttl" env:"TOKEN_TTL " env-default:"1h"`
+	MaxAppTokenTTL           time.Duration        `yaml:"max_app_token_ttl" env:"MAX_APP_TOKEN_TTL" env-default:"24h"`
+	RefreshTTL               time.Duration        `yaml:"refresh_ttl" env:"REFRESH_TTL" env-default:"720h"`
+	RememberMeTTL            time.Duration        `yaml:"remember_me_ttl" env:"REMEMBER_ME_TTL" env-default:"2160h"`
+	PasswordResetTTL         time.Duration        `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL" env-default:"15m"`
+	CleanupInterval          time.Duration        `yaml:"cleanup_interval" env-default:"1h"`
+	RevokeOnPasswordChange   bool                 `yaml:"revoke_on_password_change" env-default:"true"`
+	MaxLoginAttempts         int                  `yaml:"max_login_attempts" env-default:"5"`
+	LockoutDuration          time.Duration        `yaml:"lockout_duration" env-default:"15m"`
+	MinLoginDuration         time.Duration        `yaml:"min_login_duration" env-default:"0s"`
+	RequireEmailVerification bool                 `yaml:"require_email_verification" env-default:"false"`
+	EmailVerificationTTL     time.Duration        `yaml:"email_verification_ttl" env-default:"24h"`
+	VerifyResendCooldown     time.Duration        `yaml:"verification_resend_cooldown" env-default:"1m"`
+	MagicLinkTTL             time.Duration        `yaml:"magic_link_ttl" env:"MAGIC_LINK_TTL" env-default:"10m"`
+	DefaultRoles             []string             `yaml:"default_roles" env:"DEFAULT_ROLES"`
+	BootstrapFirstAdmin      bool                 `yaml:"bootstrap_first_admin" env:"BOOTSTRAP_FIRST_ADMIN" env-default:"false"`
+	TemporaryAdminPasswords  bool                 `yaml:"temporary_admin_passwords" env:"TEMPORARY_ADMIN_PASSWORDS" env-default:"true"`
+	TOTPEncryptionKey        string               `yaml:"totp_encryption_key" env:"TOTP_ENCRYPTION_KEY"`
+	RedactEmails             bool                 `yaml:"redact_emails" env:"REDACT_EMAILS" env-default:"false"`
+	StrictEmailValidation    bool                 `yaml:"strict_email_validation" env:"STRICT_EMAIL_VALIDATION" env-default:"true"`
+	BcryptCost               int                  `yaml:"bcrypt_cost" env:"BCRYPT_COST" env-default:"10"`
+	PasswordHash             PasswordHashConfig   `yaml:"password_hash"`
+	AdminCache               AdminCacheConfig     `yaml:"admin_cache"`
+	AppCache                 AppCacheConfig       `yaml:"app_cache"`
+	LoginRateLimit           RateLimitConfig      `yaml:"login_rate_limit"`
+	LoginWebhook             LoginWebhookConfig   `yaml:"login_webhook"`
+	Outbox                   OutboxConfig         `yaml:"outbox"`
+	PasswordPolicy           PasswordPolicyConfig `yaml:"password_policy"`
+	JWT                      JWTConfig            `yaml:"jwt"`
+	Metrics                  MetricsConfig        `yaml:"metrics"`
+	Tracing                  TracingConfig        `yaml:"tracing"`
+	HTTP                     HTTPConfig           `yaml:"http"`
+	Grpc                     GRPCConfig           `yaml:"grpc"`
+}
+
+// JWTConfig configures RS256 token signing. Keys maps key IDs to where their
+// PEM data is read from: "env:NAME" for an environment variable, or a file
+// path, optionally prefixed with "file:", e.g. a mounted secret. Keys must be
+// RSA keys of at least 2048 bits. The key named by SigningKeyID signs new
+// tokens and must be a private key, the rest only verify tokens issued before
+// a rotation. Retired maps key IDs to the time they were rotated out; such
+// keys are dropped once every token they signed has expired. Tokens are
+// signed with HS256 using the app secret when SigningKeyID is empty. Issuer,
+// if set, becomes the iss claim of new tokens and is required of validated
+// ones. Leeway is the clock skew tolerated when checking the exp and nbf
+// claims.
+type JWTConfig struct {
+	Issuer       string               `yaml:"issuer" env:"JWT_ISSUER"`
+	Leeway       time.Duration        `yaml:"leeway" env:"JWT_LEEWAY" env-default:"0s"`
+	SigningKeyID string               `yaml:"signing_key_id" env:"JWT_SIGNING_KEY_ID"`
+	Keys         map[string]string    `yaml:"keys"`
+	Retired      map[string]time.Time `yaml:"retired"`
+}
+
+// StoragePoolConfig tunes the database connection pool, see
+// storage.PoolConfig for recommended values. Zero values keep the
+// database/sql defaults.
+type StoragePoolConfig struct {
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"STORAGE_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"STORAGE_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"STORAGE_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"STORAGE_CONN_MAX_IDLE_TIME"`
+}
+
+// StorageRetryConfig controls retries of storage operations failing with
+// transient errors. MaxAttempts counts the first attempt, 1 disables retries.
+type StorageRetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts" env:"STORAGE_RETRY_MAX_ATTEMPTS" env-default:"3"`
+	BaseDelay   time.Duration `yaml:"base_delay" env:"STORAGE_RETRY_BASE_DELAY" env-default:"20ms"`
+	MaxDelay    time.Duration `yaml:"max_delay" env:"STORAGE_RETRY_MAX_DELAY" env-default:"500ms"`
+}
+
+// PasswordHashConfig selects the algorithm new password hashes are made with:
+// "bcrypt", at BcryptCost, or "argon2id". Existing hashes keep working after
+// a switch and are rehashed on the next login.
+type PasswordHashConfig struct {
+	Algorithm string         `yaml:"algorithm" env:"PASSWORD_HASH_ALGORITHM" env-default:"bcrypt"`
+	Argon2id  Argon2idConfig `yaml:"argon2id"`
+}
+
+// Argon2idConfig sets the argon2id parameters, Memory being in KiB. The
+// defaults follow RFC 9106.
+type Argon2idConfig struct {
+	Time    uint32 `yaml:"time" env-default:"3"`
+	Memory  uint32 `yaml:"memory" env-default:"65536"`
+	Threads uint8  `yaml:"threads" env-default:"4"`
+}
+
+// AdminCacheConfig configures caching of IsAdmin results. A zero TTL disables
+// the cache.
+type AdminCacheConfig struct {
+	TTL  time.Duration `yaml:"ttl" env:"ADMIN_CACHE_TTL" env-default:"0s"`
+	Size int           `yaml:"size" env:"ADMIN_CACHE_SIZE" env-default:"10000"`
+}
+
+// AppCacheConfig configures caching of apps looked up on login and token
+// validation. A zero TTL disables the cache.
+type AppCacheConfig struct {
+	TTL  time.Duration `yaml:"ttl" env:"APP_CACHE_TTL" env-default:"0s"`
+	Size int           `yaml:"size" env:"APP_CACHE_SIZE" env-default:"1000"`
+}
+
+// RateLimitConfig limits requests per client IP to Rate per second with
+// bursts of up to Burst requests. A zero Rate disables the limit.
+type RateLimitConfig struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// LoginWebhookConfig sets where login notifications are POSTed: AppURLs by
+// app ID, URL for the other apps. Without any URL no notifications are sent.
+type LoginWebhookConfig struct {
+	URL         string         `yaml:"url" env:"LOGIN_WEBHOOK_URL"`
+	AppURLs     map[int]string `yaml:"app_urls"`
+	Timeout     time.Duration  `yaml:"timeout" env-default:"5s"`
+	MaxAttempts int            `yaml:"max_attempts" env-default:"3"`
+}
+
+// OutboxConfig sets where registration and login events are published. The
+// events are written to the outbox, polled every PollInterval and POSTed to
+// URL until it accepts them. Without a URL no events are written.
+type OutboxConfig struct {
+	URL          string        `yaml:"url" env:"OUTBOX_URL"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+	Timeout      time.Duration `yaml:"timeout" env-default:"5s"`
 }
 
+// PasswordPolicyConfig sets the rules passwords must satisfy. The zero value
+// accepts any password up to the default MaxBytes, see auth.PasswordPolicy.
+type PasswordPolicyConfig struct {
+	MinLength     int  `yaml:"min_length"`
+	MaxLength     int  `yaml:"max_length"`
+	MaxBytes      int  `yaml:"max_bytes"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	RejectCommon  bool `yaml:"reject_common"`
+}
+
+// MetricsConfig enables Prometheus metrics on the HTTP server's /metrics
+// endpoint. It requires building with -tags prometheus.
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// TracingConfig enables exporting OpenTelemetry traces over OTLP/gRPC to
+// Endpoint. It requires building with -tags otel.
+type TracingConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Endpoint    string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" env-default:"localhost:4317"`
+	Insecure    bool   `yaml:"insecure"`
+	ServiceName string `yaml:"service_name" env-default:"sso"`
+}
+
+type HTTPConfig struct {
+	Port int `yaml:"port"`
+}
 type GRPCConfig struct {
 	Port    int           `yaml:"port"`
 	Timeout time.Duration `yaml:"timeout"`
+	// Reflection lets tools like grpcurl list the services without the proto
+	// files.
+	Reflection bool `yaml:"reflection" env-default:"true"`
+}
+
+// redacted replaces secrets in logged configs.
+const redacted = "REDACTED"
+
+// LogValue redacts the secrets of the config, so that it can be logged whole:
+// the TOTP encryption key and the credentials of a Postgres DSN.
+func (c Config) LogValue() slog.Value {
+	// config has Config's fields but not its methods, so that logging it
+	// doesn't call LogValue again.
+	type config Config
+
+	logged := config(c)
+	if logged.TOTPEncryptionKey != "" {
+		logged.TOTPEncryptionKey = redacted
+	}
+
+	if logged.StorageDriver == StorageDriverPostgres {
+		logged.StoragePath = redactDSN(logged.StoragePath)
+	}
+
+	return slog.AnyValue(logged)
+}
+
+// dsnPassword matches the password of a key/value Postgres DSN, quoted or not.
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// redactDSN redacts the userinfo and password parameter of a URL Postgres
+// DSN, or the password of a key/value one.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if u.User != nil {
+			u.User = url.User(redacted)
+		}
+
+		if q := u.Query(); q.Has("password") {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+
+		return u.String()
+	}
+
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+redacted)
 }
 
 func MustLoad() *Config {
@@ -1,7 +1,24 @@
 package models
 
+import "time"
+
 type App struct {
 	ID     int
 	Name   string
 	Secret string
+	// PreviousSecrets are former secrets, newest first, that HS256 tokens
+	// still validate with while the app rotates to Secret.
+	PreviousSecrets []string
+	// Claims are static claims merged into every token issued for the app.
+	Claims map[string]any
+	// TokenTTL is the lifetime of the app's access tokens. Zero means the
+	// global token TTL.
+	TokenTTL time.Duration
+	// SigningAlg is the algorithm the app's tokens are signed with, "HS256"
+	// or "RS256". Empty means RS256 when signing keys are configured and
+	// HS256 otherwise.
+	SigningAlg string
+	// BindTokens makes the app's tokens bound to the client fingerprint they
+	// were issued to, see requestmeta.Meta.Fingerprint.
+	BindTokens bool
 }
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Types of AuthEvent.
+const (
+	AuthEventLogin           = "login"
+	AuthEventLoginFailed     = "login_failed"
+	AuthEventLogout          = "logout"
+	AuthEventPasswordChange  = "password_change"
+	AuthEventPasswordSet     = "password_set"
+	AuthEventEmailChange     = "email_change"
+	AuthEventSessionsRevoked = "sessions_revoked"
+)
+
+// AuthEvent is an entry of the authentication audit log.
+type AuthEvent struct {
+	ID int64
+	// UserID is zero when the user isn't known, e.g. for a login with an
+	// unregistered email.
+	UserID int64
+	// ActorID is the user who performed the action, if they were
+	// authenticated, such as the admin revoking another user's sessions.
+	ActorID int64
+	Type    string
+	// Reason is the failure category of failed events, such as
+	// "invalid_password".
+	Reason    string
+	RequestID string
+	IP        string
+	CreatedAt time.Time
+}
@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+type LoginAttempts struct {
+	Email       string
+	FailedCount int
+	LockedUntil time.Time
+}
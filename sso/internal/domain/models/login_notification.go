@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginNotification tells a user that their account was logged in to. IP
+// and UserAgent describe the client and are empty when unknown.
+type LoginNotification struct {
+	UserID    int64
+	AppID     int
+	At        time.Time
+	IP        string
+	UserAgent string
+}
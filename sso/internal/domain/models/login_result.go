@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// LoginResult holds the tokens issued on login.
+type LoginResult struct {
+	AccessToken string
+	// ExpiresAt is the expiry of AccessToken.
+	ExpiresAt time.Time
+	UserID    int64
+	// RefreshToken can be exchanged for new access tokens via Auth.Refresh.
+	RefreshToken string
+	// PasswordChangeRequired tells the client to have the user replace the
+	// temporary password they logged in with, see Auth.AdminSetPassword.
+	// AccessToken is then limited to ScopePasswordChange and RefreshToken
+	// is empty.
+	PasswordChangeRequired bool
+}
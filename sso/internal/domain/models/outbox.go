@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Types of OutboxEvent.
+const (
+	// OutboxEventUserRegistered has a payload of the form
+	// {"email": "...", "username": "..."}, username being omitted if empty.
+	OutboxEventUserRegistered = "user_registered"
+	// OutboxEventLogin has a payload of the form {"app_id": 1}.
+	OutboxEventLogin = "login"
+)
+
+// OutboxEvent is an event written to the outbox along with the change it
+// reports, waiting to be published to other systems.
+type OutboxEvent struct {
+	ID     int64
+	Type   string
+	UserID int64
+	// Payload is the JSON-encoded body of the event.
+	Payload   []byte
+	CreatedAt time.Time
+}
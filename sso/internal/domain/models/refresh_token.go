@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	ID     int64
+	UserID int64
+	// AppID is the app the token was issued for, which is the only one it
+	// can be redeemed for. It is zero for tokens issued before tokens were
+	// bound to apps.
+	AppID int
+	// SessionID is the session the token was issued for, empty for tokens
+	// issued before sessions were introduced.
+	SessionID string
+	TokenHash []byte
+	ExpiresAt time.Time
+	Revoked   bool
+	// CreatedAt is zero for tokens issued before it was recorded, and
+	// LastUsedAt for tokens never redeemed.
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	// Device is the user agent of the client the token was issued to.
+	Device string
+	// AMR lists the methods the user authenticated with at login, which
+	// access tokens issued for the refresh token carry on.
+	AMR []string
+	// Fingerprint is the client fingerprint the token is bound to, empty for
+	// unbound tokens.
+	Fingerprint string
+}
+
+// RefreshTokenInfo describes a refresh token to its owner, leaving out the
+// token itself. ID identifies it to Auth.RevokeRefreshToken.
+type RefreshTokenInfo struct {
+	ID         string
+	SessionID  string
+	Device     string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
@@ -0,0 +1,8 @@
+package models
+
+// RoleAdmin is the role that grants administrative access.
+const RoleAdmin = "admin"
+
+// ScopePasswordChange is the only scope of the tokens issued to users who
+// must change their password, which carry no roles.
+const ScopePasswordChange = "password_change"
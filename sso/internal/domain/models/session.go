@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Session is a login on one device. Access tokens carry the ID of the
+// session they were issued for, and stop validating once it is revoked.
+type Session struct {
+	ID         string
+	UserID     int64
+	AppID      int
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	Revoked    bool
+}
+
+// Types of SessionEvent.
+const (
+	SessionEventCreated    = "created"
+	SessionEventRevoked    = "revoked"
+	SessionEventRevokedAll = "revoked_all"
+)
+
+// SessionEvent reports a change in a user's sessions. Events of type
+// SessionEventRevokedAll have no session ID, since they end every session of
+// the user.
+type SessionEvent struct {
+	Type      string
+	SessionID string
+	UserID    int64
+	AppID     int
+	At        time.Time
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+type TokenClaims struct {
+	ID        string
+	SessionID string
+	UserID    int64
+	Email     string
+	AppID     int
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Roles     []string
+	// Scopes are the scopes granted to the user through their roles, carried
+	// in the space-delimited scope claim.
+	Scopes []string
+	// AMR lists the methods the user authenticated with, such as "pwd" and
+	// "otp". It is empty for app tokens and tokens issued before it was
+	// introduced.
+	AMR []string
+	// Fingerprint is the client fingerprint the token is bound to, carried
+	// in the cnf claim. It is empty for unbound tokens.
+	Fingerprint string
+	// Type is the token type of the typ claim, "access" for the tokens
+	// issued by Login.
+	Type string
+	// GrantType is "client_credentials" for tokens issued to an app rather
+	// than a user, which have a zero UserID. It is empty for user tokens.
+	GrantType string
+}
+
+// IntrospectionResult describes a token as introspected by Auth.Introspect,
+// after RFC 7662. All fields but Active are zero for inactive tokens.
+type IntrospectionResult struct {
+	// Active is set for valid, unexpired and unrevoked tokens.
+	Active bool
+	// UserID is the subject of the token, zero for app tokens.
+	UserID    int64
+	AppID     int
+	ExpiresAt time.Time
+	Roles     []string
+	Scopes    []string
+	AMR       []string
+	GrantType string
+}
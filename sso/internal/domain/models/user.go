@@ -1,7 +1,47 @@
 package models
 
+import "time"
+
 type User struct {
-	ID       int64
-	Email    string
-	PassHash []byte
+	ID    int64
+	Email string
+	// Username is an optional alternative to Email for logging in.
+	Username   string
+	PassHash   []byte
+	IsVerified bool
+	// IsActive is false for disabled users, who can't log in until
+	// re-enabled with SetUserActive.
+	IsActive  bool
+	CreatedAt time.Time
+	// UpdatedAt is when the user's password, email, TOTP secret,
+	// verification status or active flag last changed. The SQL storages only
+	// load it and CreatedAt in ListUsers.
+	UpdatedAt time.Time
+	// TokensRevokedAt is when all of the user's tokens were last revoked;
+	// access tokens issued before it no longer validate. The SQL storages
+	// only load it in UserByID.
+	TokensRevokedAt time.Time
+	// MustChangePassword is set for users whose password was set by an
+	// admin, until they change it. Until then they only get limited tokens,
+	// see ScopePasswordChange. The SQL storages don't load it in
+	// ListUsers.
+	MustChangePassword bool
+}
+
+// UserFilter narrows down and orders the users returned by ListUsers.
+type UserFilter struct {
+	// EmailContains, if set, only matches users whose email contains it.
+	EmailContains string
+
+	// NewestFirst orders users by descending creation time instead of
+	// ascending.
+	NewestFirst bool
+}
+
+// UserImport is a user migrated from another system with an existing bcrypt
+// password hash.
+type UserImport struct {
+	Email      string
+	PassHash   []byte
+	IsVerified bool
 }
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	authservice "sso/internal/services/auth"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the domain of the ErrorInfo details attached to statuses.
+const errorDomain = "sso"
+
+type statusInfo struct {
+	code codes.Code
+	msg  string
+}
+
+// statuses maps auth error codes to the status returned for them. Codes
+// missing here are reported as internal errors.
+var statuses = map[authservice.ErrorCode]statusInfo{
+	authservice.CodeInvalidArgument:     {codes.InvalidArgument, "invalid request"},
+	authservice.CodeInvalidAppID:        {codes.InvalidArgument, "invalid app_id"},
+	authservice.CodeInvalidUserID:       {codes.InvalidArgument, "invalid user_id"},
+	authservice.CodeWeakPassword:        {codes.InvalidArgument, "password is too weak"},
+	authservice.CodePasswordTooLong:     {codes.InvalidArgument, "password is too long"},
+	authservice.CodeInvalidCredentials:  {codes.Unauthenticated, "invalid email or password"},
+	authservice.CodeUserExists:          {codes.AlreadyExists, "user already exists"},
+	authservice.CodeUsernameTaken:       {codes.AlreadyExists, "username is taken"},
+	authservice.CodeUserNotFound:        {codes.NotFound, "user not found"},
+	authservice.CodeRateLimited:         {codes.ResourceExhausted, "too many login attempts"},
+	authservice.CodeAccountLocked:       {codes.ResourceExhausted, "account is temporarily locked"},
+	authservice.CodeEmailNotVerified:    {codes.PermissionDenied, "email is not verified"},
+	authservice.CodePermissionDenied:    {codes.PermissionDenied, "permission denied"},
+	authservice.CodeAccountDisabled:     {codes.PermissionDenied, "account is disabled"},
+	authservice.CodeTOTPRequired:        {codes.FailedPrecondition, "totp code required"},
+	authservice.CodeFingerprintRequired: {codes.FailedPrecondition, "client certificate or device id required"},
+	authservice.CodeCanceled:            {codes.Canceled, "request canceled"},
+	authservice.CodeUnavailable:         {codes.Unavailable, "service unavailable"},
+}
+
+// statusFromError converts an error returned by the auth service into a
+// status. The status carries the auth error code as the reason of an
+// ErrorInfo detail, and validation errors a BadRequest detail per invalid
+// field.
+func statusFromError(err error) error {
+	code := authservice.Code(err)
+
+	info, ok := statuses[code]
+	if !ok {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	st := status.New(info.code, info.msg)
+	errorInfo := &errdetails.ErrorInfo{Reason: string(code), Domain: errorDomain}
+
+	var (
+		withDetails *status.Status
+		detailsErr  error
+		verr        *authservice.ValidationError
+	)
+
+	if errors.As(err, &verr) {
+		withDetails, detailsErr = st.WithDetails(errorInfo, badRequest(verr))
+	} else {
+		withDetails, detailsErr = st.WithDetails(errorInfo)
+	}
+
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
+
+func badRequest(verr *authservice.ValidationError) *errdetails.BadRequest {
+	details := &errdetails.BadRequest{}
+
+	for _, field := range slices.Sorted(maps.Keys(verr.Fields)) {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: verr.Fields[field],
+		})
+	}
+
+	return details
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"sso/internal/lib/requestmeta"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// MetaInterceptor returns a unary server interceptor storing the caller's
+// request ID, taken from the "x-request-id" metadata, user agent, IP address
+// and fingerprint in the request context.
+//
+// The fingerprint is the SHA-256 hash of the caller's TLS client certificate
+// or, without one, of the "x-device-id" metadata.
+func MetaInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(withRequestMeta(ctx), req)
+	}
+}
+
+// MetaStreamInterceptor is the stream server interceptor counterpart of
+// MetaInterceptor.
+func MetaStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &metaStream{ServerStream: ss, ctx: withRequestMeta(ss.Context())})
+	}
+}
+
+// metaStream is a grpc.ServerStream whose context carries the request meta.
+type metaStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *metaStream) Context() context.Context {
+	return s.ctx
+}
+
+// withRequestMeta returns ctx carrying the request meta of the incoming call.
+func withRequestMeta(ctx context.Context) context.Context {
+	meta := requestmeta.Meta{IP: peerIP(ctx)}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		meta.RequestID = firstValue(md, "x-request-id")
+		meta.UserAgent = firstValue(md, "user-agent")
+		meta.Fingerprint = hashFingerprint(firstValue(md, "x-device-id"))
+	}
+
+	if cert := peerCertificate(ctx); cert != nil {
+		meta.Fingerprint = hashFingerprint(string(cert))
+	}
+
+	return requestmeta.WithMeta(ctx, meta)
+}
+
+func firstValue(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// peerCertificate returns the DER encoding of the caller's TLS client
+// certificate, or nil if it didn't present one.
+func peerCertificate(ctx context.Context) []byte {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return info.State.PeerCertificates[0].Raw
+}
+
+func hashFingerprint(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(value))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
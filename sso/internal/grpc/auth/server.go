@@ -2,17 +2,25 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"net"
+	"sso/internal/domain/models"
+	"sso/internal/lib/ratelimit"
+	authservice "sso/internal/services/auth"
 
 	ssov1 "github.com/tyomll/sso-go/protos/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
 type Auth interface {
-	Login(ctx context.Context, email, password string, appID int) (token string, err error)
+	Login(ctx context.Context, identifier, password string, appID int) (token string, err error)
 	RegisterNewUser(ctx context.Context, email, password string) (userID int64, err error)
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	ValidateToken(ctx context.Context, token string) (models.TokenClaims, error)
+	WatchSessions(ctx context.Context, actorID, userID int64) (<-chan models.SessionEvent, error)
 }
 
 type serverAPI struct {
@@ -33,9 +41,14 @@ func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.
 		return nil, err
 	}
 
+	if ip := peerIP(ctx); ip != "" {
+		ctx = ratelimit.WithKey(ctx, ip)
+	}
+
+	// The email field also accepts a username.
 	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, statusFromError(err)
 	}
 
 	return &ssov1.LoginResponse{Token: token}, nil
@@ -48,7 +61,7 @@ func (s *serverAPI) Register(ctx context.Context, req *ssov1.RegisterRequest) (*
 
 	userID, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword())
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, statusFromError(err)
 	}
 
 	return &ssov1.RegisterResponse{UserId: userID}, nil
@@ -61,12 +74,79 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *ssov1.IsAdminRequest) (*ss
 
 	isAdmin, err := s.auth.IsAdmin(ctx, req.GetUserId())
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, statusFromError(err)
 	}
 
 	return &ssov1.IsAdminResponse{IsAdmin: isAdmin}, nil
 }
 
+// WatchSessions streams the session events the caller, authenticated by their
+// bearer token, asked for. The stream ends with codes.Aborted if the caller
+// fell too far behind, and without an error once they disconnect.
+func (s *serverAPI) WatchSessions(req *ssov1.WatchSessionsRequest, stream ssov1.Auth_WatchSessionsServer) error {
+	ctx := stream.Context()
+
+	if req.GetUserId() < 0 {
+		return status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if claims.UserID == emptyValue {
+		return status.Error(codes.PermissionDenied, "a user token is required")
+	}
+
+	events, err := s.auth.WatchSessions(ctx, claims.UserID, req.GetUserId())
+	if err != nil {
+		return statusFromError(err)
+	}
+
+	for event := range events {
+		err := stream.Send(&ssov1.SessionEvent{
+			Type:      event.Type,
+			SessionId: event.SessionID,
+			UserId:    event.UserID,
+			AppId:     int32(event.AppID),
+			Timestamp: event.At.Unix(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The channel is closed early only when the caller couldn't keep up.
+	if ctx.Err() == nil {
+		return status.Error(codes.Aborted, "too far behind, resync and watch again")
+	}
+
+	return nil
+}
+
+// authenticate returns the claims of the caller's bearer token.
+func (s *serverAPI) authenticate(ctx context.Context) (models.TokenClaims, error) {
+	token, ok := authservice.BearerToken(ctx)
+	if !ok {
+		return models.TokenClaims{}, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	claims, err := s.auth.ValidateToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, authservice.ErrInvalidToken) ||
+			errors.Is(err, authservice.ErrTokenExpired) ||
+			errors.Is(err, authservice.ErrTokenRevoked) ||
+			errors.Is(err, authservice.ErrFingerprintMismatch) {
+			return models.TokenClaims{}, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		return models.TokenClaims{}, statusFromError(err)
+	}
+
+	return claims, nil
+}
+
 func validateLogin(req *ssov1.LoginRequest) error {
 	if req.GetEmail() == "" {
 		return status.Error(codes.InvalidArgument, "email is required")
@@ -102,3 +182,19 @@ func validateIsAdmin(req *ssov1.IsAdminRequest) error {
 
 	return nil
 }
+
+// peerIP returns the IP address of the client, used as the login rate
+// limiting key.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,203 @@
+package auth_test
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"sso/internal/domain/models"
+	authrpc "sso/internal/grpc/auth"
+	"sso/internal/migrator"
+	authservice "sso/internal/services/auth"
+	"sso/internal/storage"
+	"sso/internal/storage/sqlite"
+	"testing"
+	"time"
+
+	ssov1 "github.com/tyomll/sso-go/protos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	testPassword = "correct-horse-1"
+	// testAppID is the app created by the migrations.
+	testAppID = 1
+)
+
+// newTestServer serves the auth service on top of a freshly migrated SQLite
+// database over an in-memory connection, and returns a client of it along
+// with the service. The first user to register is an admin.
+func newTestServer(t *testing.T) (ssov1.AuthClient, *authservice.Auth) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sso.db")
+
+	if err := migrator.RunMigrations(migrator.DriverSQLite, path, "../../../migrations", "", sqlite.Options{}, migrator.Up); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	s, err := sqlite.New(path, storage.PoolConfig{}, sqlite.Options{}, storage.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	t.Cleanup(func() { _ = s.Close() })
+
+	a, err := authservice.NewWithOptions(authservice.Config{
+		Log:                 slog.New(slog.DiscardHandler),
+		UserSaver:           s,
+		UserProvider:        s,
+		AppProvider:         s,
+		AppSaver:            s,
+		RefreshStore:        s,
+		TokenRevoker:        s,
+		ResetStore:          s,
+		Attempts:            s,
+		TOTPStore:           s,
+		Roles:               s,
+		VerifyStore:         s,
+		Sessions:            s,
+		TokenTTL:            time.Hour,
+		BcryptCost:          4,
+		BootstrapFirstAdmin: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(authrpc.MetaInterceptor()),
+		grpc.StreamInterceptor(authrpc.MetaStreamInterceptor()),
+	)
+	authrpc.Register(srv, a)
+
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return ssov1.NewAuthClient(conn), a
+}
+
+// registerAndLogin registers a user and returns their ID and an access token.
+func registerAndLogin(t *testing.T, a *authservice.Auth, email string) (int64, string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	userID, err := a.RegisterNewUser(ctx, email, testPassword)
+	if err != nil {
+		t.Fatalf("failed to register %s: %v", email, err)
+	}
+
+	token, err := a.Login(ctx, email, testPassword, testAppID)
+	if err != nil {
+		t.Fatalf("failed to login %s: %v", email, err)
+	}
+
+	return userID, token
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestWatchSessions(t *testing.T) {
+	client, a := newTestServer(t)
+
+	_, adminToken := registerAndLogin(t, a, "admin@example.com")
+	userID, userToken := registerAndLogin(t, a, "user@example.com")
+	_, otherToken := registerAndLogin(t, a, "other@example.com")
+
+	tests := []struct {
+		name     string
+		token    string
+		watchID  int64
+		wantCode codes.Code
+	}{
+		{name: "own sessions", token: userToken, watchID: userID, wantCode: codes.OK},
+		{name: "admin watching a user", token: adminToken, watchID: userID, wantCode: codes.OK},
+		{name: "admin watching everyone", token: adminToken, watchID: 0, wantCode: codes.OK},
+		{name: "another user's sessions", token: otherToken, watchID: userID, wantCode: codes.PermissionDenied},
+		{name: "everyone as a user", token: otherToken, watchID: 0, wantCode: codes.PermissionDenied},
+		{name: "without token", watchID: userID, wantCode: codes.Unauthenticated},
+		{name: "invalid token", token: "invalid", watchID: userID, wantCode: codes.Unauthenticated},
+		{name: "negative user id", token: adminToken, watchID: -1, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if tt.token != "" {
+				ctx = withToken(ctx, tt.token)
+			}
+
+			stream, err := client.WatchSessions(ctx, &ssov1.WatchSessionsRequest{UserId: tt.watchID})
+			if err != nil {
+				t.Fatalf("WatchSessions() error = %v", err)
+			}
+
+			if tt.wantCode != codes.OK {
+				_, err := stream.Recv()
+				if status.Code(err) != tt.wantCode {
+					t.Fatalf("Recv() error = %v, want code %s", err, tt.wantCode)
+				}
+
+				return
+			}
+
+			// The watch only starts once the server has handled the call, so
+			// keep logging in until an event comes through.
+			loggingIn := make(chan struct{})
+			defer func() { <-loggingIn }()
+
+			go func() {
+				defer close(loggingIn)
+
+				for ctx.Err() == nil {
+					_, _ = a.Login(context.Background(), "user@example.com", testPassword, testAppID)
+
+					time.Sleep(20 * time.Millisecond)
+				}
+			}()
+
+			event, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("Recv() error = %v", err)
+			}
+
+			if event.GetType() != models.SessionEventCreated || event.GetUserId() != userID || event.GetAppId() != testAppID || event.GetSessionId() == "" {
+				t.Fatalf("Recv() = %v, want a created event of user %d", event, userID)
+			}
+
+			// Cancelling the call ends the stream on both sides.
+			cancel()
+
+			for {
+				if _, err := stream.Recv(); err != nil {
+					if status.Code(err) != codes.Canceled {
+						t.Fatalf("Recv() after cancel error = %v, want code %s", err, codes.Canceled)
+					}
+
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	ssov1 "github.com/tyomll/sso-go/protos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// pingTimeout bounds a storage ping when the caller set no earlier deadline.
+const pingTimeout = 3 * time.Second
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type serverAPI struct {
+	healthgrpc.UnimplementedHealthServer
+	log    *slog.Logger
+	pinger Pinger
+}
+
+// Register exposes the standard gRPC health service. The overall status and
+// the status of the auth service are SERVING while the storage is reachable.
+func Register(gRPC *grpc.Server, log *slog.Logger, pinger Pinger) {
+	healthgrpc.RegisterHealthServer(gRPC, &serverAPI{log: log, pinger: pinger})
+}
+
+func (s *serverAPI) Check(ctx context.Context, req *healthgrpc.HealthCheckRequest) (*healthgrpc.HealthCheckResponse, error) {
+	if service := req.GetService(); service != "" && service != ssov1.Auth_ServiceDesc.ServiceName {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	if err := s.pinger.Ping(ctx); err != nil {
+		s.log.Warn("health check failed", slog.String("error", err.Error()))
+
+		return &healthgrpc.HealthCheckResponse{Status: healthgrpc.HealthCheckResponse_NOT_SERVING}, nil
+	}
+
+	return &healthgrpc.HealthCheckResponse{Status: healthgrpc.HealthCheckResponse_SERVING}, nil
+}
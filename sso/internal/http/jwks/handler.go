@@ -0,0 +1,111 @@
+package jwks
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sort"
+	"sso/internal/lib/jwt"
+	"time"
+)
+
+// Path is the conventional location of an issuer's key set.
+const Path = "/.well-known/jwks.json"
+
+// maxAge is how long clients may cache the key set. New keys should be
+// published at least this long before they start signing tokens.
+const maxAge = 5 * time.Minute
+
+// JWK is the JSON Web Key representation of an RSA public key (RFC 7517).
+type JWK struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// Set is a JSON Web Key Set.
+type Set struct {
+	Keys []JWK `json:"keys"`
+}
+
+type handler struct {
+	log  *slog.Logger
+	keys jwt.KeyProvider
+}
+
+// Register mounts the JWKS handler on mux. A nil key provider serves an
+// empty key set, since HS256 keys must never be published.
+func Register(mux *http.ServeMux, log *slog.Logger, keys jwt.KeyProvider) {
+	mux.Handle(Path, &handler{log: log, keys: keys})
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const op = "jwks.ServeHTTP"
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	body, err := json.Marshal(h.keySet())
+	if err != nil {
+		h.log.With(slog.String("op", op)).Error("failed to encode key set", slog.String("error", err.Error()))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	_, _ = w.Write(body)
+}
+
+func (h *handler) keySet() Set {
+	set := Set{Keys: []JWK{}}
+
+	if h.keys == nil {
+		return set
+	}
+
+	for kid, key := range h.keys.PublicKeys() {
+		set.Keys = append(set.Keys, newJWK(kid, key))
+	}
+
+	// Stable ordering keeps the ETag stable between requests.
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+
+	return set
+}
+
+func newJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		KeyID:     kid,
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
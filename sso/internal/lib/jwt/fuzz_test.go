@@ -0,0 +1,91 @@
+package jwt_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"testing"
+	"time"
+)
+
+const (
+	fuzzUserID = 42
+	fuzzAppID  = 1
+	fuzzSecret = "fuzz-secret"
+)
+
+// FuzzParseToken checks that ParseToken never panics and only accepts tokens
+// genuinely signed for the fuzzed app, however the input is mangled.
+func FuzzParseToken(f *testing.F) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		f.Fatalf("failed to generate key: %v", err)
+	}
+
+	keys, err := jwt.NewKeySet("fuzz", key, nil)
+	if err != nil {
+		f.Fatalf("failed to create key set: %v", err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	clock := jwt.FixedClock(now)
+	user := models.User{ID: fuzzUserID, Email: "user@example.com"}
+	hs256App := models.App{ID: fuzzAppID, Secret: fuzzSecret, SigningAlg: jwt.AlgHS256}
+	rs256App := models.App{ID: fuzzAppID, Secret: fuzzSecret, SigningAlg: jwt.AlgRS256}
+
+	sign := func(app models.App, issuedAt time.Time, ttl time.Duration) string {
+		token, err := jwt.NewToken(user, app, ttl, keys, []string{"admin"}, []string{"read"}, []string{jwt.AMRPassword}, "sid", "", "", 0, jwt.FixedClock(issuedAt))
+		if err != nil {
+			f.Fatalf("failed to sign token: %v", err)
+		}
+
+		return token
+	}
+
+	valid := sign(hs256App, now, time.Hour)
+	encode := base64.RawURLEncoding.EncodeToString
+
+	for _, seed := range []string{
+		valid,
+		sign(rs256App, now, time.Hour),
+		sign(hs256App, now.Add(-2*time.Hour), time.Hour), // expired
+		sign(hs256App, now.Add(time.Hour), time.Hour),    // not valid yet
+		valid[:len(valid)/2],                             // truncated
+		valid + "x",
+		valid[:len(valid)-1],
+		"",
+		".",
+		"..",
+		"a.b.c",
+		"a.b.c.d",
+		"not a token",
+		encode([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + encode([]byte(`{"uid":42,"app_id":1,"exp":9999999999}`)) + ".",
+		encode([]byte(`{"alg":"HS256","kid":7}`)) + "." + encode([]byte(`{"uid":"42","app_id":"1","exp":"soon"}`)) + ".c2ln",
+		encode([]byte(`{"alg":"RS256","kid":"fuzz"}`)) + "." + encode([]byte(`{"roles":[1,2],"app_id":1,"exp":9999999999}`)) + ".c2ln",
+		encode([]byte(`null`)) + "." + encode([]byte(`[]`)) + ".",
+	} {
+		f.Add(seed)
+	}
+
+	secrets := func(appID int) ([]string, error) {
+		if appID != fuzzAppID {
+			return nil, errors.New("unknown app")
+		}
+
+		return []string{fuzzSecret}, nil
+	}
+
+	f.Fuzz(func(t *testing.T, token string) {
+		claims, err := jwt.ParseToken(token, secrets, keys, "", 0, clock)
+		if err != nil {
+			return
+		}
+
+		if claims.UserID != fuzzUserID || claims.AppID != fuzzAppID {
+			t.Fatalf("ParseToken(%q) accepted claims %+v not issued by the test", token, claims)
+		}
+	})
+}
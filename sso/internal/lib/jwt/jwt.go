@@ -1,25 +1,300 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"sso/internal/domain/models"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+// Errors returned by Verify and ParseToken, to be matched with errors.Is.
+var (
+	// ErrTokenExpired means the token is past its exp claim.
+	ErrTokenExpired = jwt.ErrTokenExpired
+	// ErrTokenNotYetValid means the token is before its nbf claim.
+	ErrTokenNotYetValid = jwt.ErrTokenNotValidYet
+	// ErrInvalidSignature means the token's signature doesn't match, or it
+	// is signed with a method or key that isn't accepted.
+	ErrInvalidSignature = jwt.ErrTokenSignatureInvalid
+)
+
+const tokenIDSize = 16
+
+// Signing algorithms an app can be configured with, see
+// models.App.SigningAlg.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// IsSupportedAlg reports whether alg is a signing algorithm apps can be
+// configured with.
+func IsSupportedAlg(alg string) bool {
+	return alg == AlgHS256 || alg == AlgRS256
+}
+
+// SigningAlg returns the algorithm the app's tokens are signed with: its
+// SigningAlg, or for apps without one RS256 when keys is non-nil and HS256
+// otherwise.
+func SigningAlg(app models.App, keys KeyProvider) string {
+	if app.SigningAlg != "" {
+		return app.SigningAlg
+	}
+
+	if keys != nil {
+		return AlgRS256
+	}
+
+	return AlgHS256
+}
+
+// GrantClientCredentials is the grant_type claim of tokens issued by
+// NewAppToken.
+const GrantClientCredentials = "client_credentials"
+
+// Clock tells the current time. Token issuance and expiry checks go through
+// it so tests can control time.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// RealClock is the Clock backed by time.Now.
+var RealClock Clock = realClock{}
+
+// FixedClock is a Clock always returning the same time.
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time { return time.Time(c) }
+
+// reservedClaims are set by NewToken itself and can't be overridden by
+// app-specific claims.
+var reservedClaims = map[string]struct{}{
+	"jti": {}, "sid": {}, "uid": {}, "email": {}, "exp": {}, "app_id": {}, "roles": {},
+	"iss": {}, "sub": {}, "aud": {}, "iat": {}, "nbf": {}, "grant_type": {}, "scope": {},
+	"amr": {},
+	"cnf": {},
+	"typ": {},
+}
+
+// TokenTypeAccess is the typ claim of access tokens, so that a token issued
+// for another usage can't be presented as one. Refresh tokens are opaque
+// rather than JWTs.
+const TokenTypeAccess = "access"
+
+// Authentication methods listed in the amr claim, after RFC 8176.
+const (
+	AMRPassword  = "pwd"
+	AMROTP       = "otp"
+	AMRMagicLink = "magic"
+)
+
+// IsReservedClaim reports whether the claim is managed by NewToken.
+func IsReservedClaim(name string) bool {
+	_, ok := reservedClaims[name]
+
+	return ok
+}
+
+// NewToken issues a token for the user and app carrying the given roles and
+// the app's static claims. It is signed with the app's SigningAlg: RS256 by
+// the current signing key of keys, carrying its kid header, or HS256 with the
+// app secret, carrying its SecretKeyID as kid. Apps without one get RS256
+// when keys is non-nil and HS256 otherwise, see SigningAlg. The token expires
+// duration after clock.Now(); a nil clock means RealClock. The aud claim
+// holds the app ID, and the iss claim is set to issuer unless it is empty.
+// The token is valid from leeway before its issue time, for verifiers whose
+// clocks lag behind. A non-empty sessionID is stored in the sid claim,
+// scopes, if any, in the space-delimited scope claim, and amr, the methods
+// the user authenticated with, in the amr claim. A non-empty fingerprint
+// binds the token to the client it identifies, as the fp member of the cnf
+// claim (RFC 7800). The typ claim is TokenTypeAccess.
+func NewToken(user models.User, app models.App, duration time.Duration, keys KeyProvider, roles, scopes, amr []string, sessionID, fingerprint, issuer string, leeway time.Duration, clock Clock) (string, error) {
+	return newToken(app, duration, keys, issuer, leeway, clock, func(claims jwt.MapClaims) {
+		claims["uid"] = user.ID
+		claims["email"] = user.Email
+		claims["roles"] = roles
+
+		if len(scopes) > 0 {
+			claims["scope"] = strings.Join(scopes, " ")
+		}
+
+		if len(amr) > 0 {
+			claims["amr"] = amr
+		}
+
+		if sessionID != "" {
+			claims["sid"] = sessionID
+		}
+
+		if fingerprint != "" {
+			claims["cnf"] = map[string]any{"fp": fingerprint}
+		}
+	})
+}
+
+// NewAppToken issues a token for the app itself, as granted by the client
+// credentials flow. It has no uid, email or roles claims but a grant_type
+// claim of GrantClientCredentials; otherwise it is built like NewToken.
+func NewAppToken(app models.App, duration time.Duration, keys KeyProvider, issuer string, leeway time.Duration, clock Clock) (string, error) {
+	return newToken(app, duration, keys, issuer, leeway, clock, func(claims jwt.MapClaims) {
+		claims["grant_type"] = GrantClientCredentials
+	})
+}
+
+func newToken(app models.App, duration time.Duration, keys KeyProvider, issuer string, leeway time.Duration, clock Clock, subject func(jwt.MapClaims)) (string, error) {
+	if clock == nil {
+		clock = RealClock
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		token      *jwt.Token
+		signingKey any
+	)
+
+	switch alg := SigningAlg(app, keys); alg {
+	case AlgRS256:
+		if keys == nil {
+			return "", errors.New("RS256 signing requires a signing key")
+		}
+
+		kid, key := keys.SigningKey()
+
+		token = jwt.New(jwt.SigningMethodRS256)
+		token.Header["kid"] = kid
+		signingKey = key
+	case AlgHS256:
+		token = jwt.New(jwt.SigningMethodHS256)
+		token.Header["kid"] = SecretKeyID(app.Secret)
+		signingKey = []byte(app.Secret)
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
 
 	claims := token.Claims.(jwt.MapClaims)
-	claims["uid"] = user.ID
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(duration).Unix()
+
+	for name, value := range app.Claims {
+		if !IsReservedClaim(name) {
+			claims[name] = value
+		}
+	}
+
+	claims["jti"] = jti
+	claims["typ"] = TokenTypeAccess
+	subject(claims)
+	now := clock.Now()
+
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Add(-leeway).Unix()
+	claims["exp"] = now.Add(duration).Unix()
 	claims["app_id"] = app.ID
+	claims["aud"] = strconv.Itoa(app.ID)
+
+	if issuer != "" {
+		claims["iss"] = issuer
+	}
 
-	tokenString, err := token.SignedString([]byte(app.Secret))
+	tokenString, err := token.SignedString(signingKey)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
+
+// SecretKeyID identifies an HS256 secret in the kid header of the tokens it
+// signs, so that verifiers holding several secrets of an app pick the right
+// one. It is derived from a hash of the secret and doesn't reveal it.
+func SecretKeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// ParseToken verifies an access token issued by NewToken like Verify,
+// resolving RS256 keys from keys and HS256 secrets via secretsFunc, and
+// returns its claims.
+func ParseToken(tokenString string, secretsFunc func(appID int) ([]string, error), keys KeyProvider, issuer string, leeway time.Duration, clock Clock) (models.TokenClaims, error) {
+	opts := VerifyOptions{
+		TokenType: TokenTypeAccess,
+		Secrets:   secretsFunc,
+		Issuer:    issuer,
+		Leeway:    leeway,
+		Clock:     clock,
+	}
+
+	// Keep a nil KeyProvider a nil PublicKeyProvider.
+	if keys != nil {
+		opts.Keys = keys
+	}
+
+	claims, err := Verify(tokenString, opts)
+	if err != nil {
+		return models.TokenClaims{}, err
+	}
+
+	return claims.TokenClaims, nil
+}
+
+func numericClaim(claims jwt.MapClaims, name string) (float64, error) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return 0, fmt.Errorf("claim %q is missing or not a number", name)
+	}
+
+	return value, nil
+}
+
+// stringsClaim returns a claim holding a list of strings. A missing claim
+// yields an empty list, since tokens issued before it was introduced lack it.
+func stringsClaim(claims jwt.MapClaims, name string) ([]string, error) {
+	raw, ok := claims[name]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("claim %q is not a list", name)
+	}
+
+	values := make([]string, 0, len(list))
+
+	for _, item := range list {
+		value, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("claim %q contains a non-string value", name)
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// newTokenID returns a random identifier for the jti claim, so that an
+// individual token can be revoked before it expires.
+func newTokenID() (string, error) {
+	buf := make([]byte, tokenIDSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
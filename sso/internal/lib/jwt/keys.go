@@ -0,0 +1,351 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KeyProvider supplies the RSA keys used for RS256 tokens. Tokens carry the
+// ID of their signing key in the kid header, so keys can be rotated: the
+// current key signs new tokens while retired keys keep verifying the tokens
+// they signed until those expire.
+type KeyProvider interface {
+	PublicKeyProvider
+	// SigningKey returns the key used to sign new tokens and its ID.
+	SigningKey() (kid string, key *rsa.PrivateKey)
+	// PublicKeys returns every verification key by ID, e.g. to serve a JWKS.
+	PublicKeys() map[string]*rsa.PublicKey
+}
+
+// PublicKeyProvider supplies the keys RS256 tokens are verified with.
+type PublicKeyProvider interface {
+	// PublicKey returns the verification key with the given ID.
+	PublicKey(kid string) (*rsa.PublicKey, bool)
+}
+
+// PublicKeys is a static PublicKeyProvider, for services verifying tokens
+// without being able to sign them.
+type PublicKeys map[string]*rsa.PublicKey
+
+func (k PublicKeys) PublicKey(kid string) (*rsa.PublicKey, bool) {
+	key, ok := k[kid]
+
+	return key, ok
+}
+
+// LoadPublicKeys reads PEM-encoded RSA keys from the given key sources (see
+// KeyLoader), keyed by kid. The sources may hold either private or public
+// keys.
+func LoadPublicKeys(sources map[string]string) (PublicKeys, error) {
+	var loader KeyLoader
+
+	keys := make(PublicKeys, len(sources))
+
+	for kid, source := range sources {
+		key, err := loader.PublicKey(source)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+
+		keys[kid] = key
+	}
+
+	return keys, nil
+}
+
+// KeySet is a static KeyProvider.
+type KeySet struct {
+	signingKID string
+	signingKey *rsa.PrivateKey
+	publicKeys map[string]*rsa.PublicKey
+
+	// retiredUntil holds, for keys rotated out, the time after which no
+	// token they signed can still be valid.
+	retiredUntil map[string]time.Time
+}
+
+// NewKeySet returns a key set signing with the private key identified by
+// signingKID. Every key in publicKeys is accepted for verification; the
+// signing key's public half is added automatically.
+func NewKeySet(signingKID string, signingKey *rsa.PrivateKey, publicKeys map[string]*rsa.PublicKey) (*KeySet, error) {
+	if signingKID == "" {
+		return nil, errors.New("signing key id is empty")
+	}
+
+	if signingKey == nil {
+		return nil, errors.New("signing key is nil")
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(publicKeys)+1)
+	for kid, key := range publicKeys {
+		keys[kid] = key
+	}
+
+	keys[signingKID] = &signingKey.PublicKey
+
+	return &KeySet{
+		signingKID:   signingKID,
+		signingKey:   signingKey,
+		publicKeys:   keys,
+		retiredUntil: make(map[string]time.Time),
+	}, nil
+}
+
+// LoadKeySet reads PEM-encoded RSA keys from the given key sources (see
+// KeyLoader), keyed by kid. The source for signingKID must hold a private
+// key; the others may hold either a private or a public key and are used for
+// verification only.
+func LoadKeySet(signingKID string, sources map[string]string) (*KeySet, error) {
+	var loader KeyLoader
+
+	source, ok := sources[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("no key source for signing key %q", signingKID)
+	}
+
+	signingKey, err := loader.PrivateKey(source)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %q: %w", signingKID, err)
+	}
+
+	publicKeys := make(map[string]*rsa.PublicKey, len(sources))
+
+	for kid, source := range sources {
+		if kid == signingKID {
+			continue
+		}
+
+		key, err := loader.PublicKey(source)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+
+		publicKeys[kid] = key
+	}
+
+	return NewKeySet(signingKID, signingKey, publicKeys)
+}
+
+func (k *KeySet) SigningKey() (string, *rsa.PrivateKey) {
+	return k.signingKID, k.signingKey
+}
+
+// RetireKey marks a verification key as rotated out. It keeps verifying (and
+// being published) until the given time, which should be when the last token
+// it signed expires, and is dropped afterwards. The signing key can't be retired.
+func (k *KeySet) RetireKey(kid string, until time.Time) error {
+	if kid == k.signingKID {
+		return fmt.Errorf("key %q is the signing key", kid)
+	}
+
+	if _, ok := k.publicKeys[kid]; !ok {
+		return fmt.Errorf("unknown key %q", kid)
+	}
+
+	k.retiredUntil[kid] = until
+
+	return nil
+}
+
+func (k *KeySet) PublicKey(kid string) (*rsa.PublicKey, bool) {
+	key, ok := k.publicKeys[kid]
+	if !ok || !k.active(kid, time.Now()) {
+		return nil, false
+	}
+
+	return key, true
+}
+
+func (k *KeySet) PublicKeys() map[string]*rsa.PublicKey {
+	now := time.Now()
+
+	keys := make(map[string]*rsa.PublicKey, len(k.publicKeys))
+	for kid, key := range k.publicKeys {
+		if k.active(kid, now) {
+			keys[kid] = key
+		}
+	}
+
+	return keys
+}
+
+// KeyIDs returns the IDs of all active verification keys in sorted order.
+func (k *KeySet) KeyIDs() []string {
+	keys := k.PublicKeys()
+
+	ids := make([]string, 0, len(keys))
+	for kid := range keys {
+		ids = append(ids, kid)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// active reports whether the key can still have valid tokens in circulation.
+func (k *KeySet) active(kid string, now time.Time) bool {
+	until, retired := k.retiredUntil[kid]
+
+	return !retired || now.Before(until)
+}
+
+// MinRSAKeyBits is the least RSA key size KeyLoader accepts.
+const MinRSAKeyBits = 2048
+
+// KeyLoader reads PEM-encoded RSA keys from key sources, which are either
+// "env:NAME", an environment variable holding the PEM data, or "file:PATH"
+// or a bare path, a file holding it, such as a mounted Kubernetes secret.
+// Keys smaller than MinRSAKeyBits are rejected. The zero value reads from the
+// process environment and the local filesystem.
+type KeyLoader struct {
+	// LookupEnv defaults to os.LookupEnv.
+	LookupEnv func(key string) (string, bool)
+	// ReadFile defaults to os.ReadFile.
+	ReadFile func(name string) ([]byte, error)
+}
+
+// PrivateKey loads the private key from the source.
+func (l KeyLoader) PrivateKey(source string) (*rsa.PrivateKey, error) {
+	block, err := l.readPEM(source)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKeySize(&key.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// PublicKey loads the public key from the source, which may hold either a
+// private or a public key.
+func (l KeyLoader) PublicKey(source string) (*rsa.PublicKey, error) {
+	block, err := l.readPEM(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var key *rsa.PublicKey
+
+	switch block.Type {
+	case "RSA PRIVATE KEY", "PRIVATE KEY":
+		privateKey, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+
+		key = &privateKey.PublicKey
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		rsaKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("not an RSA public key")
+		}
+
+		key = rsaKey
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+
+	if err := checkKeySize(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// read returns the contents of the source. Missing or empty sources are an
+// error.
+func (l KeyLoader) read(source string) ([]byte, error) {
+	if name, ok := strings.CutPrefix(source, "env:"); ok {
+		lookupEnv := l.LookupEnv
+		if lookupEnv == nil {
+			lookupEnv = os.LookupEnv
+		}
+
+		value, ok := lookupEnv(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("environment variable %q is not set", name)
+		}
+
+		return []byte(value), nil
+	}
+
+	path := strings.TrimPrefix(source, "file:")
+	if path == "" {
+		return nil, errors.New("empty key source")
+	}
+
+	readFile := l.ReadFile
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+
+	return readFile(path)
+}
+
+func (l KeyLoader) readPEM(source string) (*pem.Block, error) {
+	data, err := l.read(source)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (*rsa.PrivateKey, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("not an RSA private key")
+		}
+
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q, want a private key", block.Type)
+	}
+}
+
+func checkKeySize(key *rsa.PublicKey) error {
+	if bits := key.N.BitLen(); bits < MinRSAKeyBits {
+		return fmt.Errorf("%d-bit key is smaller than %d bits", bits, MinRSAKeyBits)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sso/internal/domain/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of a token verified by Verify. Beyond the claims the
+// Auth service works with, they include the registered ones a standalone
+// verifier may want to check itself.
+type Claims struct {
+	models.TokenClaims
+	Issuer    string
+	Audience  []string
+	NotBefore time.Time
+}
+
+// VerifyOptions configure Verify. At least one of Keys and Secrets must be
+// set for any token to verify.
+type VerifyOptions struct {
+	// Keys verifies RS256 tokens by their kid header. RS256 tokens are
+	// rejected if it is nil.
+	Keys PublicKeyProvider
+	// Secrets returns the HS256 secrets of the app the token was issued for:
+	// its current one and any it is being rotated away from. Tokens are
+	// checked against the secret matching their kid header or, lacking one,
+	// each secret in turn. HS256 tokens are rejected if it is nil.
+	Secrets func(appID int) ([]string, error)
+	// TokenType, if non-empty, must equal the token's typ claim, such as
+	// TokenTypeAccess. Tokens without one, issued before it was introduced,
+	// pass as access tokens.
+	TokenType string
+	// Issuer, if non-empty, must equal the token's iss claim.
+	Issuer string
+	// Leeway is the clock skew tolerated when checking the exp and nbf
+	// claims.
+	Leeway time.Duration
+	// Clock tells the time the token is checked at; nil means RealClock.
+	Clock Clock
+}
+
+// Verify checks the signature and registered claims of a token issued by
+// NewToken or NewAppToken and returns its claims. It needs neither the Auth
+// service nor a storage, so services that only accept tokens can verify them
+// with the published public keys, or the app secrets for HS256 tokens.
+//
+// Only HS256 and RS256 tokens are accepted, not "none". The verification key
+// type always follows the signing method in the alg header, so a token can't
+// pass by being HMAC-signed with an RSA public key. The aud claim, when
+// present, must name the token's app; tokens issued before it was introduced
+// lack it.
+//
+// Verify returns ErrTokenExpired, ErrTokenNotYetValid or ErrInvalidSignature
+// for the respective failures, and another error if the token is malformed,
+// its issuer doesn't match or its claims don't have the expected types.
+func Verify(tokenString string, opts VerifyOptions) (Claims, error) {
+	clock := opts.Clock
+	if clock == nil {
+		clock = RealClock
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(clock.Now),
+		jwt.WithLeeway(opts.Leeway),
+	}
+
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+			if opts.Keys == nil {
+				return nil, fmt.Errorf("%w: RS256 tokens are not accepted", ErrInvalidSignature)
+			}
+
+			kid, _ := token.Header["kid"].(string)
+
+			key, ok := opts.Keys.PublicKey(kid)
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidSignature, kid)
+			}
+
+			return key, nil
+		}
+
+		if opts.Secrets == nil {
+			return nil, fmt.Errorf("%w: HS256 tokens are not accepted", ErrInvalidSignature)
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, errors.New("unexpected claims type")
+		}
+
+		appID, err := numericClaim(claims, "app_id")
+		if err != nil {
+			return nil, err
+		}
+
+		secrets, err := opts.Secrets(int(appID))
+		if err != nil {
+			return nil, err
+		}
+
+		if kid, ok := token.Header["kid"].(string); ok {
+			for _, secret := range secrets {
+				if SecretKeyID(secret) == kid {
+					return []byte(secret), nil
+				}
+			}
+
+			return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidSignature, kid)
+		}
+
+		// Tokens issued before secrets got a kid.
+		keySet := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, 0, len(secrets))}
+		for _, secret := range secrets {
+			keySet.Keys = append(keySet.Keys, []byte(secret))
+		}
+
+		return keySet, nil
+	}, parserOpts...)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	tokenType := TokenTypeAccess
+	if typ, ok := claims["typ"]; ok {
+		if tokenType, ok = typ.(string); !ok {
+			return Claims{}, fmt.Errorf("invalid typ claim %v", typ)
+		}
+	}
+
+	if opts.TokenType != "" && tokenType != opts.TokenType {
+		return Claims{}, fmt.Errorf("token type %q, want %q", tokenType, opts.TokenType)
+	}
+
+	// App tokens have no user.
+	grantType, _ := claims["grant_type"].(string)
+
+	var uid float64
+	if grantType != GrantClientCredentials {
+		uid, err = numericClaim(claims, "uid")
+		if err != nil {
+			return Claims{}, err
+		}
+	}
+
+	appID, err := numericClaim(claims, "app_id")
+	if err != nil {
+		return Claims{}, err
+	}
+
+	aud, err := claims.GetAudience()
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if len(aud) > 0 && !slices.Contains(aud, strconv.Itoa(int(appID))) {
+		return Claims{}, fmt.Errorf("token audience %v doesn't match app %d", []string(aud), int(appID))
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return Claims{}, err
+	}
+
+	roles, err := stringsClaim(claims, "roles")
+	if err != nil {
+		return Claims{}, err
+	}
+
+	amr, err := stringsClaim(claims, "amr")
+	if err != nil {
+		return Claims{}, err
+	}
+
+	var fingerprint string
+	if cnf, ok := claims["cnf"]; ok {
+		members, ok := cnf.(map[string]any)
+		if !ok {
+			return Claims{}, errors.New("cnf claim is not an object")
+		}
+
+		if fingerprint, ok = members["fp"].(string); !ok || fingerprint == "" {
+			return Claims{}, errors.New("cnf claim has no fingerprint")
+		}
+	}
+
+	email, _ := claims["email"].(string)
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+	scope, _ := claims["scope"].(string)
+	iss, _ := claims["iss"].(string)
+
+	result := Claims{
+		TokenClaims: models.TokenClaims{
+			ID:          jti,
+			SessionID:   sid,
+			UserID:      int64(uid),
+			Email:       email,
+			AppID:       int(appID),
+			ExpiresAt:   exp.Time,
+			Roles:       roles,
+			Scopes:      strings.Fields(scope),
+			AMR:         amr,
+			Fingerprint: fingerprint,
+			Type:        tokenType,
+			GrantType:   grantType,
+		},
+		Issuer:   iss,
+		Audience: aud,
+	}
+
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		result.IssuedAt = iat.Time
+	}
+
+	if nbf, err := claims.GetNotBefore(); err == nil && nbf != nil {
+		result.NotBefore = nbf.Time
+	}
+
+	return result, nil
+}
@@ -0,0 +1,71 @@
+package jwt_test
+
+import (
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseTokenChecksType(t *testing.T) {
+	const secret = "test-secret"
+
+	now := time.Unix(1_700_000_000, 0)
+	clock := jwt.FixedClock(now)
+	app := models.App{ID: 1, Secret: secret, SigningAlg: jwt.AlgHS256}
+
+	token, err := jwt.NewToken(models.User{ID: 42, Email: "user@example.com"}, app, time.Hour, nil, nil, nil, nil, "", "", "", 0, clock)
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	// withType re-signs the token with its typ claim replaced, or removed if
+	// typ is nil.
+	withType := func(t *testing.T, typ any) string {
+		t.Helper()
+
+		claims := gojwt.MapClaims{}
+		if _, _, err := gojwt.NewParser().ParseUnverified(token, claims); err != nil {
+			t.Fatalf("failed to parse token: %v", err)
+		}
+
+		delete(claims, "typ")
+		if typ != nil {
+			claims["typ"] = typ
+		}
+
+		signed, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+
+		return signed
+	}
+
+	secrets := func(int) ([]string, error) {
+		return []string{secret}, nil
+	}
+
+	tests := []struct {
+		name    string
+		typ     any
+		wantErr bool
+	}{
+		{name: "access", typ: jwt.TokenTypeAccess},
+		{name: "no type", typ: nil},
+		{name: "refresh", typ: "refresh", wantErr: true},
+		{name: "id token", typ: "id", wantErr: true},
+		{name: "non-string type", typ: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.ParseToken(withType(t, tt.typ), secrets, nil, "", 0, clock)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// Package passhash hashes passwords with bcrypt or argon2id. Hashes are
+// self-describing, so Compare verifies a password against a hash from either
+// algorithm and both can coexist while users are migrated between them.
+package passhash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var (
+	ErrMismatch      = errors.New("password doesn't match the hash")
+	ErrUnknownFormat = errors.New("unknown password hash format")
+)
+
+// argon2idPrefix starts argon2id hashes in the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>.
+const argon2idPrefix = "$argon2id$"
+
+var b64 = base64.RawStdEncoding
+
+// Algorithm returns the algorithm the hash was produced with, or an empty
+// string if it isn't a bcrypt or argon2id hash.
+func Algorithm(hash []byte) string {
+	if bytes.HasPrefix(hash, []byte(argon2idPrefix)) {
+		return AlgorithmArgon2id
+	}
+
+	if _, err := bcrypt.Cost(hash); err == nil {
+		return AlgorithmBcrypt
+	}
+
+	return ""
+}
+
+// Compare checks password against a hash produced by Bcrypt or Argon2id,
+// picking the algorithm from the hash. It returns ErrMismatch if the password
+// is wrong and ErrUnknownFormat if the hash is neither.
+func Compare(hash []byte, password string) error {
+	switch Algorithm(hash) {
+	case AlgorithmArgon2id:
+		return Argon2id{}.Compare(hash, password)
+	case AlgorithmBcrypt:
+		return Bcrypt{}.Compare(hash, password)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// Bcrypt hashes passwords with bcrypt at the given cost. Only the first 72
+// bytes of a password are significant.
+type Bcrypt struct {
+	Cost int
+}
+
+func (h Bcrypt) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+}
+
+// Compare checks password against a bcrypt hash of any cost.
+func (h Bcrypt) Compare(hash []byte, password string) error {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+
+	return err
+}
+
+// NeedsRehash reports whether hash isn't a bcrypt hash of at least h.Cost.
+func (h Bcrypt) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+
+	return err != nil || cost < h.Cost
+}
+
+// Argon2id hashes passwords with argon2id. Memory is in KiB.
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+const (
+	argon2idSaltLen = 16
+	argon2idKeyLen  = 32
+)
+
+// DefaultArgon2id returns the parameters recommended by RFC 9106 for systems
+// that can't afford its first choice of 2 GiB of memory per hash.
+func DefaultArgon2id() Argon2id {
+	return Argon2id{Time: 3, Memory: 64 * 1024, Threads: 4}
+}
+
+func (h Argon2id) Hash(password string) ([]byte, error) {
+	if h.Time < 1 || h.Memory < 8*uint32(h.Threads) || h.Threads < 1 {
+		return nil, fmt.Errorf("invalid argon2id parameters t=%d m=%d p=%d", h.Time, h.Memory, h.Threads)
+	}
+
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, argon2idKeyLen)
+
+	return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, h.Memory, h.Time, h.Threads, b64.EncodeToString(salt), b64.EncodeToString(key),
+	)), nil
+}
+
+// Compare checks password against an argon2id hash, using the parameters
+// stored in the hash rather than those of h.
+func (h Argon2id) Compare(hash []byte, password string) error {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	got := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether hash isn't an argon2id hash with h's
+// parameters.
+func (h Argon2id) NeedsRehash(hash []byte) bool {
+	params, _, _, err := parseArgon2id(hash)
+
+	return err != nil || params != h
+}
+
+func parseArgon2id(hash []byte) (params Argon2id, salt, key []byte, err error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return Argon2id{}, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2id{}, nil, nil, fmt.Errorf("%w: unsupported argon2id version", ErrUnknownFormat)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return Argon2id{}, nil, nil, fmt.Errorf("%w: invalid argon2id parameters", ErrUnknownFormat)
+	}
+
+	if params.Time < 1 || params.Threads < 1 {
+		return Argon2id{}, nil, nil, fmt.Errorf("%w: invalid argon2id parameters", ErrUnknownFormat)
+	}
+
+	if salt, err = b64.DecodeString(parts[4]); err != nil {
+		return Argon2id{}, nil, nil, fmt.Errorf("%w: invalid argon2id salt", ErrUnknownFormat)
+	}
+
+	if key, err = b64.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return Argon2id{}, nil, nil, fmt.Errorf("%w: invalid argon2id key", ErrUnknownFormat)
+	}
+
+	return params, salt, key, nil
+}
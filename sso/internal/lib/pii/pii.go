@@ -0,0 +1,21 @@
+// Package pii masks personal data before it is logged.
+package pii
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MaskEmail keeps the first character of the local part and the domain of
+// an email, e.g. "john@example.com" becomes "j***@example.com". Strings that
+// aren't emails are masked entirely.
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+
+	first, _ := utf8.DecodeRuneInString(local)
+
+	return string(first) + "***@" + domain
+}
@@ -0,0 +1,97 @@
+// Package ratelimit provides an in-memory token-bucket rate limiter and
+// helpers to pass the rate limiting key through a context.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type keyCtx struct{}
+
+// WithKey returns a context carrying the key callers are rate limited by,
+// such as their IP address.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyCtx{}, key)
+}
+
+// KeyFromContext returns the key stored by WithKey, or an empty string.
+func KeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(keyCtx{}).(string)
+
+	return key
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucket limits each key to a steady rate of requests per second with
+// bursts of up to burst requests. It is safe for concurrent use.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewTokenBucket returns a limiter refilling rate tokens per second up to
+// burst tokens per key. The rate must be positive.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the key's bucket and reports whether one was
+// available. It never returns an error.
+func (l *TokenBucket) Allow(_ context.Context, key string) (bool, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, nil
+	}
+
+	b.tokens--
+
+	return true, nil
+}
+
+// sweep drops buckets that have refilled completely, as they are
+// indistinguishable from new ones. It runs at most once per refill period so
+// memory stays bounded by the number of recently seen keys.
+func (l *TokenBucket) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
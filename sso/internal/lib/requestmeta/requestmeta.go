@@ -0,0 +1,31 @@
+// Package requestmeta passes details about the caller of a request, such as
+// their IP address, through a context.
+package requestmeta
+
+import "context"
+
+// Meta describes the caller of a request. Fields are empty when unknown.
+type Meta struct {
+	// RequestID is the caller-supplied ID correlating the request across
+	// services.
+	RequestID string
+	IP        string
+	UserAgent string
+	// Fingerprint identifies the client device, e.g. by its TLS client
+	// certificate, for binding tokens to it.
+	Fingerprint string
+}
+
+type metaCtx struct{}
+
+// WithMeta returns a context carrying meta.
+func WithMeta(ctx context.Context, meta Meta) context.Context {
+	return context.WithValue(ctx, metaCtx{}, meta)
+}
+
+// FromContext returns the Meta stored by WithMeta, or a zero Meta.
+func FromContext(ctx context.Context) Meta {
+	meta, _ := ctx.Value(metaCtx{}).(Meta)
+
+	return meta
+}
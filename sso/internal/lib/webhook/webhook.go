@@ -0,0 +1,190 @@
+// Package webhook delivers login notifications and outbox events to HTTP
+// endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sso/internal/domain/models"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultTimeout     = 5 * time.Second
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = 500 * time.Millisecond
+)
+
+// LoginNotifier POSTs login notifications as JSON to a URL, retrying
+// failed deliveries. It implements auth.LoginNotifier.
+type LoginNotifier struct {
+	// URL receives the notifications of apps missing from AppURLs. Empty
+	// drops them.
+	URL string
+	// AppURLs maps app IDs to the URL receiving their notifications.
+	AppURLs map[int]string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// Timeout bounds each delivery attempt. Zero means five seconds.
+	Timeout time.Duration
+	// MaxAttempts counts the first attempt. Zero means three.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled on every
+	// further one. Zero means half a second.
+	BaseDelay time.Duration
+}
+
+// payload is the body of a notification. It carries no email, so that
+// notifications don't leak PII to endpoints that only need to alert.
+type payload struct {
+	UserID    int64     `json:"user_id"`
+	AppID     int       `json:"app_id"`
+	Timestamp time.Time `json:"timestamp"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// NotifyLogin delivers the notification, retrying network errors, 429 and
+// 5xx responses until MaxAttempts is reached or ctx is done.
+func (n *LoginNotifier) NotifyLogin(ctx context.Context, notification models.LoginNotification) error {
+	const op = "webhook.NotifyLogin"
+
+	url := n.URL
+	if appURL, ok := n.AppURLs[notification.AppID]; ok {
+		url = appURL
+	}
+
+	if url == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(payload{
+		UserID:    notification.UserID,
+		AppID:     notification.AppID,
+		Timestamp: notification.At.UTC(),
+		IP:        notification.IP,
+		UserAgent: notification.UserAgent,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	attempts := n.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultMaxAttempts
+	}
+
+	delay := n.BaseDelay
+	if delay <= 0 {
+		delay = defaultBaseDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := post(ctx, n.Client, n.Timeout, url, nil, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempt >= attempts {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// OutboxPublisher POSTs outbox events as JSON to a URL. It implements
+// auth.OutboxPublisher, which retries failed deliveries on its next poll.
+type OutboxPublisher struct {
+	URL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// Timeout bounds each delivery. Zero means five seconds.
+	Timeout time.Duration
+}
+
+// outboxPayload is the body of an outbox event delivery.
+type outboxPayload struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	UserID    int64           `json:"user_id,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Publish delivers the event. Since events may be delivered more than once,
+// requests carry the event ID in the Idempotency-Key header for the endpoint
+// to deduplicate by.
+func (p *OutboxPublisher) Publish(ctx context.Context, event models.OutboxEvent) error {
+	const op = "webhook.Publish"
+
+	body, err := json.Marshal(outboxPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		UserID:    event.UserID,
+		Payload:   event.Payload,
+		CreatedAt: event.CreatedAt.UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	header := http.Header{"Idempotency-Key": {strconv.FormatInt(event.ID, 10)}}
+
+	if _, err := post(ctx, p.Client, p.Timeout, p.URL, header, body); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// post makes one delivery attempt with the given extra headers and reports
+// whether a failure is worth retrying. A nil client means
+// http.DefaultClient, and a non-positive timeout five seconds.
+func post(ctx context.Context, client *http.Client, timeout time.Duration, url string, header http.Header, body []byte) (retry bool, err error) {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
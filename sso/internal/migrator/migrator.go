@@ -0,0 +1,111 @@
+// Package migrator applies the SQL migrations of the service. It backs both
+// the migrator command and the -auto-migrate option of the service itself.
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sso/internal/storage/sqlite"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// Direction is the direction migrations are applied in.
+type Direction string
+
+const (
+	Up   Direction = "up"
+	Down Direction = "down"
+)
+
+// New opens the migrations in the migrationsPath directory for the database
+// at storagePath, recording the applied version in the given table. An empty
+// table means the golang-migrate default. SQLite databases are opened with
+// sqliteOpts, which should match those of the service, so that migrating
+// waits for its writes instead of failing with "database is locked".
+func New(driver, storagePath, migrationsPath, table string, sqliteOpts sqlite.Options) (*migrate.Migrate, error) {
+	databaseURL, err := DatabaseURL(driver, storagePath, table, sqliteOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New("file://"+migrationsPath, databaseURL)
+}
+
+// Run migrates in the given direction, by the given number of steps or all
+// the way if steps is zero. It returns migrate.ErrNoChange if there was
+// nothing to apply.
+func Run(m *migrate.Migrate, direction Direction, steps int) error {
+	switch {
+	case steps > 0 && direction == Down:
+		return m.Steps(-steps)
+	case steps > 0:
+		return m.Steps(steps)
+	case direction == Down:
+		return m.Down()
+	default:
+		return m.Up()
+	}
+}
+
+// RunMigrations applies every pending migration in the given direction.
+// Having nothing to apply isn't an error.
+func RunMigrations(driver, storagePath, migrationsPath, table string, sqliteOpts sqlite.Options, direction Direction) error {
+	const op = "migrator.RunMigrations"
+
+	m, err := New(driver, storagePath, migrationsPath, table, sqliteOpts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer m.Close()
+
+	if err := Run(m, direction, 0); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DatabaseURL returns the golang-migrate database URL for the given driver.
+// For postgres, storagePath is expected to be a postgres:// connection URL,
+// and sqliteOpts are ignored.
+func DatabaseURL(driver, storagePath, table string, sqliteOpts sqlite.Options) (string, error) {
+	switch driver {
+	case DriverSQLite:
+		databaseURL := "sqlite3://" + sqlite.DSN(storagePath, sqliteOpts)
+		if table == "" {
+			return databaseURL, nil
+		}
+
+		sep := "?"
+		if strings.Contains(databaseURL, "?") {
+			sep = "&"
+		}
+
+		return databaseURL + sep + "x-migrations-table=" + url.QueryEscape(table), nil
+	case DriverPostgres:
+		u, err := url.Parse(storagePath)
+		if err != nil {
+			return "", fmt.Errorf("invalid postgres connection URL: %w", err)
+		}
+
+		if table != "" {
+			q := u.Query()
+			q.Set("x-migrations-table", table)
+			u.RawQuery = q.Encode()
+		}
+
+		return u.String(), nil
+	default:
+		return "", fmt.Errorf("unknown driver %q", driver)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build postgres
+
+// PostgreSQL support pulls in the lib/pq driver, so it is only compiled into
+// the migrator when building with -tags postgres.
+package migrator
+
+import _ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// AdminCache is a UserProvider caching the results of IsAdmin for a short
+// time, keeping at most size users and evicting the least recently used one
+// first. All other methods go straight to the wrapped provider.
+//
+// Auth flushes a user's entry when their roles change or they are deleted.
+// Changes made by other instances of the service or directly in the database
+// are picked up once the entry expires. It is safe for concurrent use.
+type AdminCache struct {
+	UserProvider
+
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[int64]*list.Element
+	lru     *list.List
+	// flushes is bumped by FlushAdmin, so that results fetched before a flush
+	// aren't cached after it.
+	flushes uint64
+}
+
+type adminCacheEntry struct {
+	userID    int64
+	isAdmin   bool
+	expiresAt time.Time
+}
+
+// NewAdminCache returns an AdminCache in front of next, caching results for
+// ttl and keeping at most size users. Both must be positive.
+func NewAdminCache(next UserProvider, ttl time.Duration, size int) *AdminCache {
+	return &AdminCache{
+		UserProvider: next,
+		ttl:          ttl,
+		size:         size,
+		entries:      make(map[int64]*list.Element),
+		lru:          list.New(),
+	}
+}
+
+// IsAdmin returns the cached result for the user, asking the wrapped provider
+// if there is none or it has expired. Errors aren't cached.
+func (c *AdminCache) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	isAdmin, ok, flushes := c.get(userID)
+	if ok {
+		return isAdmin, nil
+	}
+
+	isAdmin, err := c.UserProvider.IsAdmin(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	c.put(userID, isAdmin, flushes)
+
+	return isAdmin, nil
+}
+
+// FlushAdmin drops the cached result for the user, if any.
+func (c *AdminCache) FlushAdmin(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.flushes++
+
+	if elem, ok := c.entries[userID]; ok {
+		c.remove(elem)
+	}
+}
+
+// get returns the cached result for the user and whether there was one, along
+// with the current flush count to pass to put.
+func (c *AdminCache) get(userID int64) (bool, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[userID]
+	if !ok {
+		return false, false, c.flushes
+	}
+
+	entry := elem.Value.(*adminCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.remove(elem)
+
+		return false, false, c.flushes
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return entry.isAdmin, true, c.flushes
+}
+
+func (c *AdminCache) put(userID int64, isAdmin bool, flushes uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.flushes != flushes {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.ttl)
+
+	if elem, ok := c.entries[userID]; ok {
+		entry := elem.Value.(*adminCacheEntry)
+		entry.isAdmin = isAdmin
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(elem)
+
+		return
+	}
+
+	c.entries[userID] = c.lru.PushFront(&adminCacheEntry{
+		userID:    userID,
+		isAdmin:   isAdmin,
+		expiresAt: expiresAt,
+	})
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *AdminCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*adminCacheEntry).userID)
+}
+
+// adminFlusher is implemented by UserProviders caching IsAdmin, such as
+// AdminCache.
+type adminFlusher interface {
+	FlushAdmin(userID int64)
+}
+
+// flushAdmin drops the user's cached admin status, if the user provider
+// caches it.
+func (a *Auth) flushAdmin(userID int64) {
+	if f, ok := a.userProvider.(adminFlusher); ok {
+		f.FlushAdmin(userID)
+	}
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"sso/internal/domain/models"
+	"sync"
+	"time"
+)
+
+// AppCache is an AppProvider caching apps for a short time, keeping at most
+// size apps and evicting the least recently used one first, so that logins
+// don't hit the storage for an app that rarely changes.
+//
+// Auth flushes an app's entry when its secret, claims or token TTL change, or
+// it is deleted. Changes made by other instances of the service or directly
+// in the database are picked up once the entry expires; until then, tokens
+// signed with a rotated-out secret keep validating on this instance. It is
+// safe for concurrent use.
+type AppCache struct {
+	next AppProvider
+
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[int]*list.Element
+	lru     *list.List
+	// flushes is bumped by FlushApp and Flush, so that apps fetched before a
+	// flush aren't cached after it.
+	flushes uint64
+}
+
+type appCacheEntry struct {
+	app       models.App
+	expiresAt time.Time
+}
+
+// NewAppCache returns an AppCache in front of next, caching apps for ttl and
+// keeping at most size apps. Both must be positive.
+func NewAppCache(next AppProvider, ttl time.Duration, size int) *AppCache {
+	return &AppCache{
+		next:    next,
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[int]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// App returns the cached app, asking the wrapped provider if there is none or
+// it has expired. Errors, including ErrAppNotFound, aren't cached.
+func (c *AppCache) App(ctx context.Context, appID int) (models.App, error) {
+	app, ok, flushes := c.get(appID)
+	if ok {
+		return app, nil
+	}
+
+	app, err := c.next.App(ctx, appID)
+	if err != nil {
+		return models.App{}, err
+	}
+
+	c.put(app, flushes)
+
+	return app, nil
+}
+
+// ListApps lists the apps of the wrapped provider, bypassing the cache.
+func (c *AppCache) ListApps(ctx context.Context) ([]models.App, error) {
+	return c.next.ListApps(ctx)
+}
+
+// FlushApp drops the cached app, if any.
+func (c *AppCache) FlushApp(appID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.flushes++
+
+	if elem, ok := c.entries[appID]; ok {
+		c.remove(elem)
+	}
+}
+
+// Flush drops every cached app.
+func (c *AppCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.flushes++
+	c.entries = make(map[int]*list.Element)
+	c.lru.Init()
+}
+
+// get returns the cached app and whether there was one, along with the
+// current flush count to pass to put.
+func (c *AppCache) get(appID int) (models.App, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[appID]
+	if !ok {
+		return models.App{}, false, c.flushes
+	}
+
+	entry := elem.Value.(*appCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.remove(elem)
+
+		return models.App{}, false, c.flushes
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return entry.app, true, c.flushes
+}
+
+func (c *AppCache) put(app models.App, flushes uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.flushes != flushes {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.ttl)
+
+	if elem, ok := c.entries[app.ID]; ok {
+		entry := elem.Value.(*appCacheEntry)
+		entry.app = app
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(elem)
+
+		return
+	}
+
+	c.entries[app.ID] = c.lru.PushFront(&appCacheEntry{
+		app:       app,
+		expiresAt: expiresAt,
+	})
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *AppCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*appCacheEntry).app.ID)
+}
+
+// appFlusher is implemented by AppProviders caching apps, such as AppCache.
+type appFlusher interface {
+	FlushApp(appID int)
+}
+
+// flushApp drops the cached app, if the app provider caches apps.
+func (a *Auth) flushApp(appID int) {
+	if f, ok := a.appProvider.(appFlusher); ok {
+		f.FlushApp(appID)
+	}
+}
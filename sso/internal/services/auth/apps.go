@@ -0,0 +1,386 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/storage"
+	"time"
+)
+
+// UpdateAppClaims replaces the static claims merged into every token issued
+// for the app.
+//
+// The method returns ErrReservedClaim if a claim would override one set by the
+// service itself, such as exp, uid or app_id, and ErrAppNotFound if the app
+// doesn't exist.
+func (a *Auth) UpdateAppClaims(ctx context.Context, appID int, claims map[string]any) error {
+	const op = "auth.UpdateAppClaims"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	log.Info("updating app claims")
+
+	for name := range claims {
+		if jwt.IsReservedClaim(name) {
+			log.Warn("reserved claim", slog.String("claim", name))
+
+			return opError(op, fmt.Errorf("%q: %w", name, ErrReservedClaim))
+		}
+	}
+
+	if err := a.appSaver.UpdateAppClaims(ctx, appID, claims); err != nil {
+		log.Error("failed to update app claims", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	a.flushApp(appID)
+
+	log.Info("app claims updated")
+
+	return nil
+}
+
+// UpdateAppTokenTTL sets the TTL of access tokens issued for the app. A zero
+// ttl makes the app use the global token TTL again.
+//
+// The method returns ErrInvalidTokenTTL if ttl is negative or exceeds the
+// configured maximum, and ErrAppNotFound if the app doesn't exist.
+func (a *Auth) UpdateAppTokenTTL(ctx context.Context, appID int, ttl time.Duration) error {
+	const op = "auth.UpdateAppTokenTTL"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID), slog.Duration("ttl", ttl))
+
+	log.Info("updating app token ttl")
+
+	if ttl < 0 || (a.maxAppTokenTTL > 0 && ttl > a.maxAppTokenTTL) {
+		log.Warn("invalid token ttl", slog.Duration("max", a.maxAppTokenTTL))
+
+		return opError(op, ErrInvalidTokenTTL)
+	}
+
+	if err := a.appSaver.UpdateAppTokenTTL(ctx, appID, ttl); err != nil {
+		log.Error("failed to update app token ttl", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	a.flushApp(appID)
+
+	log.Info("app token ttl updated")
+
+	return nil
+}
+
+// UpdateAppSigningAlg sets the algorithm the app's tokens are signed with,
+// jwt.AlgHS256 or jwt.AlgRS256, for relying parties supporting only one. An
+// empty alg restores the default: RS256 if signing keys are configured, HS256
+// otherwise. Tokens already issued keep validating until they expire, except
+// HS256 ones of an app switched to RS256, which stop validating at once.
+//
+// The method returns ErrInvalidSigningAlg if alg isn't supported, or is RS256
+// without a signing key configured, and ErrAppNotFound if the app doesn't
+// exist.
+func (a *Auth) UpdateAppSigningAlg(ctx context.Context, appID int, alg string) error {
+	const op = "auth.UpdateAppSigningAlg"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID), slog.String("alg", alg))
+
+	log.Info("updating app signing algorithm")
+
+	if alg != "" && (!jwt.IsSupportedAlg(alg) || alg == jwt.AlgRS256 && a.keys == nil) {
+		log.Warn("invalid signing algorithm")
+
+		return opError(op, ErrInvalidSigningAlg)
+	}
+
+	if err := a.appSaver.UpdateAppSigningAlg(ctx, appID, alg); err != nil {
+		log.Error("failed to update app signing algorithm", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	a.flushApp(appID)
+
+	log.Info("app signing algorithm updated")
+
+	return nil
+}
+
+// UpdateAppTokenBinding sets whether the app's tokens are bound to the
+// fingerprint of the client they are issued to, such as its TLS client
+// certificate, so that a stolen token is rejected when presented by another
+// client. Logins to a binding app fail with ErrFingerprintRequired when the
+// client has no fingerprint. Tokens already issued keep their binding, or
+// lack of it, until they expire.
+//
+// The method returns ErrAppNotFound if the app doesn't exist.
+func (a *Auth) UpdateAppTokenBinding(ctx context.Context, appID int, bind bool) error {
+	const op = "auth.UpdateAppTokenBinding"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID), slog.Bool("bind", bind))
+
+	log.Info("updating app token binding")
+
+	if err := a.appSaver.UpdateAppTokenBinding(ctx, appID, bind); err != nil {
+		log.Error("failed to update app token binding", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	a.flushApp(appID)
+
+	log.Info("app token binding updated")
+
+	return nil
+}
+
+// ListApps returns all registered apps, ordered by ID, along with their
+// claims, token TTL, signing algorithm and token binding, so that operators
+// can audit them. Secrets are never included.
+func (a *Auth) ListApps(ctx context.Context) ([]models.App, error) {
+	const op = "auth.ListApps"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("listing apps")
+
+	apps, err := a.appProvider.ListApps(ctx)
+	if err != nil {
+		log.Error("failed to list apps", slog.String("error", err.Error()))
+
+		return nil, opError(op, err)
+	}
+
+	for i := range apps {
+		apps[i].Secret = ""
+		apps[i].PreviousSecrets = nil
+	}
+
+	log.Info("apps listed", slog.Int("count", len(apps)))
+
+	return apps, nil
+}
+
+// RegisterApp creates an app with a randomly generated secret and returns its
+// ID and secret. The secret signs the app's HS256 tokens, so it is stored as
+// is rather than hashed; it is only ever returned here and by
+// RotateAppSecret.
+//
+// The method returns ErrAppExists if an app with the same name exists.
+func (a *Auth) RegisterApp(ctx context.Context, name string) (appID int, secret string, err error) {
+	const op = "auth.RegisterApp"
+
+	log := a.log.With(slog.String("op", op), slog.String("name", name))
+
+	log.Info("registering app")
+
+	secret, err = newOpaqueToken()
+	if err != nil {
+		log.Error("failed to generate app secret", slog.String("error", err.Error()))
+
+		return 0, "", opError(op, err)
+	}
+
+	appID, err = a.appSaver.SaveApp(ctx, name, secret)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			log.Warn("app already exists", slog.String("error", err.Error()))
+
+			return 0, "", opError(op, ErrAppExists)
+		}
+
+		log.Error("failed to save app", slog.String("error", err.Error()))
+
+		return 0, "", opError(op, err)
+	}
+
+	log.Info("app registered", slog.Int("app_id", appID))
+
+	return appID, secret, nil
+}
+
+// maxPreviousAppSecrets caps the previous secrets AddAppSecret keeps, each of
+// which ValidateToken may try.
+const maxPreviousAppSecrets = 3
+
+// RotateAppSecret replaces the app's secret with a new random one and returns
+// it. HS256 tokens signed with the previous secret, or any kept by
+// AddAppSecret, stop validating at once, as after the secret leaked; use
+// AddAppSecret to rotate without invalidating live tokens.
+//
+// The method returns ErrAppNotFound if the app doesn't exist.
+func (a *Auth) RotateAppSecret(ctx context.Context, appID int) (secret string, err error) {
+	const op = "auth.RotateAppSecret"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	log.Info("rotating app secret")
+
+	secret, err = newOpaqueToken()
+	if err != nil {
+		log.Error("failed to generate app secret", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if err := a.appSaver.UpdateAppSecret(ctx, appID, secret); err != nil {
+		log.Error("failed to update app secret", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	a.flushApp(appID)
+
+	log.Info("app secret rotated")
+
+	return secret, nil
+}
+
+// AddAppSecret replaces the app's secret with a new random one and returns it,
+// keeping the current secret for validating the HS256 tokens it has already
+// signed. New tokens are signed with the new secret. Once the tokens signed
+// with the old one have expired, drop it with DropPreviousAppSecrets. Only
+// the last few previous secrets are kept.
+//
+// The method returns ErrAppNotFound if the app doesn't exist.
+func (a *Auth) AddAppSecret(ctx context.Context, appID int) (secret string, err error) {
+	const op = "auth.AddAppSecret"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	log.Info("adding app secret")
+
+	secret, err = newOpaqueToken()
+	if err != nil {
+		log.Error("failed to generate app secret", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if err := a.appSaver.AddAppSecret(ctx, appID, secret, maxPreviousAppSecrets); err != nil {
+		log.Error("failed to add app secret", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	a.flushApp(appID)
+
+	log.Info("app secret added")
+
+	return secret, nil
+}
+
+// DropPreviousAppSecrets forgets the secrets the app was rotated away from
+// with AddAppSecret, so that the HS256 tokens they signed stop validating.
+//
+// The method returns ErrAppNotFound if the app doesn't exist.
+func (a *Auth) DropPreviousAppSecrets(ctx context.Context, appID int) error {
+	const op = "auth.DropPreviousAppSecrets"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	log.Info("dropping previous app secrets")
+
+	if err := a.appSaver.DropPreviousAppSecrets(ctx, appID); err != nil {
+		log.Error("failed to drop previous app secrets", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	a.flushApp(appID)
+
+	log.Info("previous app secrets dropped")
+
+	return nil
+}
+
+// DeleteApp removes the app, so users can no longer log in to it.
+//
+// The method returns ErrAppNotFound if the app doesn't exist.
+func (a *Auth) DeleteApp(ctx context.Context, appID int) error {
+	const op = "auth.DeleteApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	log.Info("deleting app")
+
+	if err := a.appSaver.DeleteApp(ctx, appID); err != nil {
+		log.Error("failed to delete app", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	a.flushApp(appID)
+
+	log.Info("app deleted")
+
+	return nil
+}
+
+// LoginApp authenticates an app by its secret and issues it a token of its
+// own, for machine-to-machine calls without a user account. The token has no
+// user and carries a grant_type claim of "client_credentials". App secrets
+// sign HS256 tokens and are stored as is, so the secret is compared in
+// constant time rather than against a hash.
+//
+// The method returns ErrInvalidAppID if appID isn't positive,
+// ErrRateLimited if the caller exceeded the login rate limit, and
+// ErrInvalidCredentials if the app doesn't exist or the secret is wrong.
+func (a *Auth) LoginApp(ctx context.Context, appID int, appSecret string) (token string, err error) {
+	const op = "auth.LoginApp"
+
+	ctx, end := a.startSpan(ctx, op)
+	defer end(&err)
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	log.Info("attempting to login app")
+
+	if appID <= 0 {
+		log.Warn("invalid app id")
+
+		return "", opError(op, ErrInvalidAppID)
+	}
+
+	if err := a.checkRateLimit(ctx); err != nil {
+		return "", opError(op, err)
+	}
+
+	spanCtx, endApp := a.startSpan(ctx, "storage.App")
+	app, err := a.appProvider.App(spanCtx, appID)
+	endApp(&err)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", slog.String("error", err.Error()))
+
+			return "", opError(op, ErrInvalidCredentials)
+		}
+
+		log.Error("failed to get app", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(app.Secret), []byte(appSecret)) != 1 {
+		log.Warn("invalid app secret")
+
+		return "", opError(op, ErrInvalidCredentials)
+	}
+
+	token, err = jwt.NewAppToken(app, a.appTokenTTL(app), a.keys, a.issuer, a.leeway, a.clock)
+	if err != nil {
+		log.Error("failed to create token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	log.Info("app logged in successfully")
+
+	return token, nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/requestmeta"
+)
+
+// maxAuthEventsLimit caps the number of events returned by AuthEvents.
+const maxAuthEventsLimit = 100
+
+// AuthEvents returns up to limit of the user's most recent audit log events,
+// newest first. Limits outside of 1..100 are clamped to 100.
+func (a *Auth) AuthEvents(ctx context.Context, userID int64, limit int) ([]models.AuthEvent, error) {
+	const op = "auth.AuthEvents"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	if a.auditLog == nil {
+		return nil, nil
+	}
+
+	if limit <= 0 || limit > maxAuthEventsLimit {
+		limit = maxAuthEventsLimit
+	}
+
+	events, err := a.auditLog.AuthEvents(ctx, userID, limit)
+	if err != nil {
+		log.Error("failed to get auth events", slog.String("error", err.Error()))
+
+		return nil, opError(op, err)
+	}
+
+	return events, nil
+}
+
+// recordEvent appends an event, along with the caller's user ID, request ID
+// and IP address, to the audit log. A failed write is logged but doesn't fail the
+// operation being audited.
+func (a *Auth) recordEvent(ctx context.Context, eventType string, userID int64, reason string) {
+	// Calls authenticated by AuthInterceptor carry the caller's claims.
+	actor, _ := ClaimsFromContext(ctx)
+
+	a.recordEventBy(ctx, eventType, actor.UserID, userID, reason)
+}
+
+// recordEventBy is recordEvent for an operation whose actor is known
+// otherwise, e.g. passed by the caller.
+func (a *Auth) recordEventBy(ctx context.Context, eventType string, actorID, userID int64, reason string) {
+	if a.auditLog == nil {
+		return
+	}
+
+	meta := requestmeta.FromContext(ctx)
+
+	event := models.AuthEvent{
+		UserID:    userID,
+		ActorID:   actorID,
+		Type:      eventType,
+		Reason:    reason,
+		RequestID: meta.RequestID,
+		IP:        meta.IP,
+		CreatedAt: a.clock.Now(),
+	}
+
+	// The event is recorded even if the request was cancelled right after the
+	// operation completed.
+	if err := a.auditLog.SaveAuthEvent(context.WithoutCancel(ctx), event); err != nil {
+		a.log.Error("failed to save auth event",
+			slog.String("event", eventType),
+			slog.Int64("user_id", userID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// recordLoginFailure records a failed login with the failure category of err
+// and, if known, the user whose credentials were rejected.
+func (a *Auth) recordLoginFailure(ctx context.Context, err error) {
+	var credErr credentialsError
+	errors.As(err, &credErr)
+
+	a.recordEvent(ctx, models.AuthEventLoginFailed, credErr.userID, failureReason(err))
+}
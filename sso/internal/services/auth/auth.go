@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sso/internal/domain/models"
 	"sso/internal/lib/jwt"
+	"sso/internal/lib/passhash"
+	"sso/internal/lib/pii"
 	"sso/internal/storage"
 	"time"
 
@@ -18,129 +21,1142 @@ type Auth struct {
 	userSaver    UserSaver
 	userProvider UserProvider
 	appProvider  AppProvider
+	appSaver     AppSaver
+	refreshStore RefreshTokenStorage
+	tokenRevoker TokenRevoker
+	resetStore   PasswordResetStorage
+	attempts     LoginAttemptsStorage
+	totpStore    TOTPStorage
+	roles        RoleStorage
+	verifyStore  EmailVerificationStorage
+	auditLog     AuditLogStorage
+	sessions     SessionStorage
+	magicLinks   MagicLinkStorage
+	outbox       OutboxStorage
+	keys         jwt.KeyProvider
+	issuer       string
+	leeway       time.Duration
+	clock        jwt.Clock
+	tracer       Tracer
 	tokenTTL     time.Duration
+	refreshTTL   time.Duration
+	resetTTL     time.Duration
+	verifyTTL    time.Duration
+
+	// magicLinkTTL is how long a magic link issued by RequestMagicLink can
+	// be used to log in.
+	magicLinkTTL time.Duration
+
+	// verifyResendCooldown is the least time between two verification
+	// emails sent to a user by ResendVerification.
+	verifyResendCooldown time.Duration
+
+	// outboxPollInterval is how often RunOutboxPublisher looks for pending
+	// events.
+	outboxPollInterval time.Duration
+
+	// rememberMeTTL is the refresh token TTL for logins with
+	// LoginOptions.RememberMe. Zero makes them use refreshTTL.
+	rememberMeTTL time.Duration
+
+	// maxAppTokenTTL caps the token TTL apps may set for themselves. Apps
+	// without one get tokenTTL.
+	maxAppTokenTTL time.Duration
+
+	// maxLoginAttempts is the number of consecutive failed logins after which
+	// the account is locked for lockoutDuration. Zero disables the lockout.
+	maxLoginAttempts int
+	lockoutDuration  time.Duration
+
+	// minLoginDuration is the least time a login takes whatever its outcome,
+	// to flatten timing differences and slow down brute force. Zero disables
+	// it.
+	minLoginDuration time.Duration
+
+	// revokeOnPasswordChange makes ChangePassword revoke every refresh token
+	// issued to the user.
+	revokeOnPasswordChange bool
+
+	// totpKey encrypts TOTP secrets at rest. TOTP can't be enabled when it
+	// is empty.
+	totpKey []byte
+
+	passwordPolicy PasswordPolicy
+
+	// strictEmails makes input validation parse emails as RFC 5322
+	// addresses instead of only checking for an "@".
+	strictEmails bool
+
+	// defaultRoles are assigned to users when they register.
+	defaultRoles []string
+	// bootstrapFirstAdmin makes the first user to register an admin.
+	bootstrapFirstAdmin bool
+	// temporaryAdminPasswords flags users whose password was set by an
+	// admin as having to change it.
+	temporaryAdminPasswords bool
+
+	// hasher hashes new passwords. Stored hashes are checked with the
+	// algorithm that produced them, so changing it doesn't invalidate them;
+	// they are rehashed on the next successful login instead.
+	hasher PasswordHasher
+
+	// dummyHash is compared against when the user doesn't exist, so that
+	// unknown emails take as long to reject as wrong passwords.
+	dummyHash []byte
+
+	hooks Hooks
+	// loginNotifier is told about successful logins. Nil disables login
+	// notifications.
+	loginNotifier LoginNotifier
+
+	// redactEmails masks email addresses in logs.
+	redactEmails bool
+
+	// limiter throttles logins by the key set with ratelimit.WithKey. Nil
+	// disables rate limiting.
+	limiter RateLimiter
+
+	// requireEmailVerification makes Login reject users who haven't verified
+	// their email yet.
+	requireEmailVerification bool
+	// sessionEvents feeds WatchSessions.
+	sessionEvents sessionHub
 }
 
 type UserSaver interface {
-	SaveUser(ctx context.Context, email string, passHash []byte) (uid int64, err error)
+	SaveUser(ctx context.Context, email, username string, passHash []byte, roles, firstUserRoles []string, events []models.OutboxEvent) (uid int64, err error)
+	UpdatePassword(ctx context.Context, userID int64, passHash []byte, mustChange bool) error
+	SetPasswordChangeRequired(ctx context.Context, userID int64, required bool) error
+	UpdateEmail(ctx context.Context, userID int64, email string) error
+	SetUserActive(ctx context.Context, userID int64, active bool) error
+	DeleteUser(ctx context.Context, userID int64, deletedAt time.Time) error
+	EraseUser(ctx context.Context, userID int64) error
+	ImportUsers(ctx context.Context, users []models.UserImport) ([]error, error)
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
+	UserByUsername(ctx context.Context, username string) (models.User, error)
+	UserExists(ctx context.Context, email string) (bool, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	ListUsers(ctx context.Context, filter models.UserFilter, limit, offset int) ([]models.User, int64, error)
 }
 
 type AppProvider interface {
 	App(ctx context.Context, appID int) (models.App, error)
+	ListApps(ctx context.Context) ([]models.App, error)
+}
+
+type AppSaver interface {
+	SaveApp(ctx context.Context, name, secret string) (appID int, err error)
+	UpdateAppSecret(ctx context.Context, appID int, secret string) error
+	AddAppSecret(ctx context.Context, appID int, secret string, keep int) error
+	DropPreviousAppSecrets(ctx context.Context, appID int) error
+	DeleteApp(ctx context.Context, appID int) error
+	UpdateAppClaims(ctx context.Context, appID int, claims map[string]any) error
+	UpdateAppTokenTTL(ctx context.Context, appID int, ttl time.Duration) error
+	UpdateAppSigningAlg(ctx context.Context, appID int, alg string) error
+	UpdateAppTokenBinding(ctx context.Context, appID int, bind bool) error
+}
+
+type RefreshTokenStorage interface {
+	SaveRefreshToken(ctx context.Context, token models.RefreshToken) error
+	RefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error)
+	ListRefreshTokens(ctx context.Context, userID int64, now time.Time) ([]models.RefreshToken, error)
+	TouchRefreshToken(ctx context.Context, id int64, usedAt time.Time) error
+	RevokeRefreshTokenByID(ctx context.Context, id int64) error
+	RevokeRefreshTokens(ctx context.Context, userID int64) error
+}
+
+type TokenRevoker interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	DeleteExpiredRevokedTokens(ctx context.Context, before time.Time) (int64, error)
+	RevokeUserTokens(ctx context.Context, userID int64, revokedAt time.Time) error
+}
+
+type PasswordResetStorage interface {
+	SavePasswordReset(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) error
+	ConsumePasswordReset(ctx context.Context, tokenHash []byte, now time.Time) (userID int64, err error)
+}
+
+// MagicLinkStorage keeps the single-use tokens of passwordless logins.
+type MagicLinkStorage interface {
+	SaveMagicLink(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) error
+	ConsumeMagicLink(ctx context.Context, tokenHash []byte, now time.Time) (userID int64, err error)
+}
+
+type LoginAttemptsStorage interface {
+	LoginAttempts(ctx context.Context, email string) (models.LoginAttempts, error)
+	IncrementFailedLogins(ctx context.Context, email string) (failedCount int, err error)
+	LockAccount(ctx context.Context, email string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, email string) error
+}
+
+type RoleStorage interface {
+	AssignRole(ctx context.Context, userID int64, role string) error
+	RevokeRole(ctx context.Context, userID int64, role string) error
+	UserRoles(ctx context.Context, userID int64) ([]string, error)
+	GrantScope(ctx context.Context, role, scope string) error
+	RevokeScope(ctx context.Context, role, scope string) error
+	UserScopes(ctx context.Context, userID int64) ([]string, error)
+}
+
+type EmailVerificationStorage interface {
+	SaveEmailVerification(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) error
+	VerifyEmail(ctx context.Context, tokenHash []byte, now time.Time) (userID int64, err error)
+	MarkVerificationSent(ctx context.Context, userID int64, sentAt, since time.Time) (marked bool, err error)
+}
+
+// AuditLogStorage keeps the authentication audit log. Events are only ever
+// appended.
+type AuditLogStorage interface {
+	SaveAuthEvent(ctx context.Context, event models.AuthEvent) error
+	AuthEvents(ctx context.Context, userID int64, limit int) ([]models.AuthEvent, error)
 }
 
-// New returns a new instance of the Auth service
-func New(log *slog.Logger, userSaver UserSaver, userProvider UserProvider, appProvider AppProvider, tokenTTL time.Duration) *Auth {
+// OutboxStorage keeps events for other systems until they are published.
+// Events reporting a change are written in the same transaction as the
+// change, where the storage method making it takes them.
+type OutboxStorage interface {
+	SaveOutboxEvent(ctx context.Context, event models.OutboxEvent) error
+	PendingOutboxEvents(ctx context.Context, limit int) ([]models.OutboxEvent, error)
+	MarkOutboxEventSent(ctx context.Context, id int64, sentAt time.Time) error
+	DeleteSentOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+// SessionStorage keeps track of the devices users are logged in on.
+type SessionStorage interface {
+	SaveSession(ctx context.Context, session models.Session) error
+	Session(ctx context.Context, sessionID string) (models.Session, error)
+	TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error
+	ListSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+}
+
+// PasswordHasher hashes passwords. passhash.Bcrypt and passhash.Argon2id
+// implement it. Hashers that also implement NeedsRehash(hash []byte) bool get
+// outdated hashes replaced on login.
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Compare(hash []byte, password string) error
+}
+
+// RateLimiter decides whether a request identified by key may proceed.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (bool, error)
+}
+
+type TOTPStorage interface {
+	// TOTPSecret returns the encrypted TOTP secret of the user, or nil if
+	// two-factor authentication is not enabled.
+	TOTPSecret(ctx context.Context, userID int64) ([]byte, error)
+	SetTOTPSecret(ctx context.Context, userID int64, encryptedSecret []byte) error
+}
+
+// Config holds the dependencies and settings of the Auth service. Every
+// storage is required except AuditLog, Sessions and MagicLinks: a nil
+// AuditLog disables the audit log, nil Sessions disables session tracking and
+// nil MagicLinks disables passwordless logins.
+type Config struct {
+	// Log defaults to slog.Default.
+	Log *slog.Logger
+
+	UserSaver    UserSaver
+	UserProvider UserProvider
+	AppProvider  AppProvider
+	AppSaver     AppSaver
+	RefreshStore RefreshTokenStorage
+	TokenRevoker TokenRevoker
+	ResetStore   PasswordResetStorage
+	Attempts     LoginAttemptsStorage
+	TOTPStore    TOTPStorage
+	Roles        RoleStorage
+	VerifyStore  EmailVerificationStorage
+	AuditLog     AuditLogStorage
+	Sessions     SessionStorage
+	MagicLinks   MagicLinkStorage
+	// Outbox makes registrations and logins write events for
+	// RunOutboxPublisher to publish.
+	Outbox OutboxStorage
+
+	// Keys signs access tokens with RS256. Without it tokens are signed with
+	// the app secret.
+	Keys   jwt.KeyProvider
+	Issuer string
+	Leeway time.Duration
+
+	TokenTTL       time.Duration
+	MaxAppTokenTTL time.Duration
+	RefreshTTL     time.Duration
+	// RememberMeTTL must be longer than RefreshTTL if set.
+	RememberMeTTL time.Duration
+	ResetTTL      time.Duration
+	VerifyTTL     time.Duration
+	// MagicLinkTTL is how long magic links stay valid. Zero means ten
+	// minutes.
+	MagicLinkTTL time.Duration
+	// VerifyResendCooldown is the least time between two ResendVerification
+	// emails to a user. Zero means a minute.
+	VerifyResendCooldown time.Duration
+	// OutboxPollInterval is how often RunOutboxPublisher looks for pending
+	// events. Zero means a second.
+	OutboxPollInterval time.Duration
+
+	RevokeOnPasswordChange bool
+	MaxLoginAttempts       int
+	LockoutDuration        time.Duration
+	MinLoginDuration       time.Duration
+
+	TOTPKey                  []byte
+	RequireEmailVerification bool
+	PasswordPolicy           PasswordPolicy
+	StrictEmails             bool
+
+	// DefaultRoles are assigned to new users along with their registration,
+	// and created if they don't exist.
+	DefaultRoles []string
+	// BootstrapFirstAdmin grants the admin role to the first user to register,
+	// for single-tenant deployments. It has no effect once a user exists.
+	BootstrapFirstAdmin bool
+	// TemporaryAdminPasswords makes users change passwords set with
+	// AdminSetPassword on their next login.
+	TemporaryAdminPasswords bool
+
+	// BcryptCost is the cost of bcrypt hashes when Hasher is nil. Zero means
+	// bcrypt.DefaultCost.
+	BcryptCost int
+	Hasher     PasswordHasher
+
+	// Limiter, Tracer and Hooks are optional. A nil Clock means
+	// jwt.RealClock.
+	Limiter RateLimiter
+	Clock   jwt.Clock
+	Tracer  Tracer
+	Hooks   Hooks
+	// LoginNotifier, if set, is told about every successful login in the
+	// background, like Hooks.
+	LoginNotifier LoginNotifier
+
+	RedactEmails bool
+}
+
+// NewWithOptions returns a new instance of the Auth service configured by
+// cfg. It returns an error if a required dependency is missing or a setting
+// is out of range, such as a non-positive TokenTTL, so that misconfiguration
+// fails at startup rather than as a nil pointer dereference in a request.
+func NewWithOptions(cfg Config) (*Auth, error) {
+	const op = "auth.NewWithOptions"
+
+	for _, dep := range []struct {
+		name    string
+		missing bool
+	}{
+		{"user saver", cfg.UserSaver == nil},
+		{"user provider", cfg.UserProvider == nil},
+		{"app provider", cfg.AppProvider == nil},
+		{"app saver", cfg.AppSaver == nil},
+		{"refresh token storage", cfg.RefreshStore == nil},
+		{"token revoker", cfg.TokenRevoker == nil},
+		{"password reset storage", cfg.ResetStore == nil},
+		{"login attempts storage", cfg.Attempts == nil},
+		{"totp storage", cfg.TOTPStore == nil},
+		{"role storage", cfg.Roles == nil},
+		{"email verification storage", cfg.VerifyStore == nil},
+	} {
+		if dep.missing {
+			return nil, fmt.Errorf("%s: %s is required", op, dep.name)
+		}
+	}
+
+	if cfg.TokenTTL <= 0 {
+		return nil, fmt.Errorf("%s: token ttl must be positive, got %s", op, cfg.TokenTTL)
+	}
+
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
+
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("%s: bcrypt cost %d is outside of [%d, %d]", op, cfg.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	if cfg.RememberMeTTL != 0 && cfg.RememberMeTTL <= cfg.RefreshTTL {
+		return nil, fmt.Errorf("%s: remember me ttl %s is not longer than refresh ttl %s", op, cfg.RememberMeTTL, cfg.RefreshTTL)
+	}
+
+	if cfg.VerifyResendCooldown == 0 {
+		cfg.VerifyResendCooldown = defaultVerifyResendCooldown
+	}
+
+	if cfg.MagicLinkTTL == 0 {
+		cfg.MagicLinkTTL = defaultMagicLinkTTL
+	}
+
+	if cfg.OutboxPollInterval == 0 {
+		cfg.OutboxPollInterval = defaultOutboxPollInterval
+	}
+
+	defaultRoles := make([]string, 0, len(cfg.DefaultRoles))
+	for _, role := range cfg.DefaultRoles {
+		role, err := normalizeRole(role)
+		if err != nil {
+			return nil, fmt.Errorf("%s: default roles: %w", op, err)
+		}
+
+		if !slices.Contains(defaultRoles, role) {
+			defaultRoles = append(defaultRoles, role)
+		}
+	}
+
+	if cfg.Log == nil {
+		cfg.Log = slog.Default()
+	}
+
+	if cfg.Clock == nil {
+		cfg.Clock = jwt.RealClock
+	}
+
+	if cfg.Tracer == nil {
+		cfg.Tracer = noopTracer{}
+	}
+
+	if cfg.Hasher == nil {
+		cfg.Hasher = passhash.Bcrypt{Cost: cfg.BcryptCost}
+	}
+
 	return &Auth{
-		userSaver:    userSaver,
-		userProvider: userProvider,
-		appProvider:  appProvider,
-		tokenTTL:     tokenTTL,
-		log:          log,
+		userSaver:    cfg.UserSaver,
+		userProvider: cfg.UserProvider,
+		appProvider:  cfg.AppProvider,
+		appSaver:     cfg.AppSaver,
+		refreshStore: cfg.RefreshStore,
+		tokenRevoker: cfg.TokenRevoker,
+		resetStore:   cfg.ResetStore,
+		attempts:     cfg.Attempts,
+		totpStore:    cfg.TOTPStore,
+		roles:        cfg.Roles,
+		verifyStore:  cfg.VerifyStore,
+		auditLog:     cfg.AuditLog,
+		sessions:     cfg.Sessions,
+		magicLinks:   cfg.MagicLinks,
+		outbox:       cfg.Outbox,
+		keys:         cfg.Keys,
+		issuer:       cfg.Issuer,
+		leeway:       cfg.Leeway,
+		clock:        cfg.Clock,
+		tracer:       cfg.Tracer,
+		tokenTTL:     cfg.TokenTTL,
+		refreshTTL:   cfg.RefreshTTL,
+		resetTTL:     cfg.ResetTTL,
+		verifyTTL:    cfg.VerifyTTL,
+		magicLinkTTL: cfg.MagicLinkTTL,
+		log:          cfg.Log,
+
+		maxAppTokenTTL:         cfg.MaxAppTokenTTL,
+		rememberMeTTL:          cfg.RememberMeTTL,
+		verifyResendCooldown:   cfg.VerifyResendCooldown,
+		outboxPollInterval:     cfg.OutboxPollInterval,
+		revokeOnPasswordChange: cfg.RevokeOnPasswordChange,
+		maxLoginAttempts:       cfg.MaxLoginAttempts,
+		lockoutDuration:        cfg.LockoutDuration,
+		minLoginDuration:       cfg.MinLoginDuration,
+		totpKey:                cfg.TOTPKey,
+
+		requireEmailVerification: cfg.RequireEmailVerification,
+		passwordPolicy:           cfg.PasswordPolicy,
+		strictEmails:             cfg.StrictEmails,
+		defaultRoles:             defaultRoles,
+		bootstrapFirstAdmin:      cfg.BootstrapFirstAdmin,
+		temporaryAdminPasswords:  cfg.TemporaryAdminPasswords,
+		hasher:                   cfg.Hasher,
+		dummyHash:                newDummyHash(cfg.Hasher),
+		limiter:                  cfg.Limiter,
+		hooks:                    cfg.Hooks,
+		loginNotifier:            cfg.LoginNotifier,
+		redactEmails:             cfg.RedactEmails,
+	}, nil
+}
+
+// New returns a new instance of the Auth service from positional arguments,
+// see Config for their meaning. It panics where NewWithOptions would return
+// an error. New settings are only added to Config.
+func New(
+	log *slog.Logger,
+	userSaver UserSaver,
+	userProvider UserProvider,
+	appProvider AppProvider,
+	appSaver AppSaver,
+	refreshStore RefreshTokenStorage,
+	tokenRevoker TokenRevoker,
+	resetStore PasswordResetStorage,
+	attempts LoginAttemptsStorage,
+	totpStore TOTPStorage,
+	roles RoleStorage,
+	verifyStore EmailVerificationStorage,
+	auditLog AuditLogStorage,
+	sessions SessionStorage,
+	keys jwt.KeyProvider,
+	issuer string,
+	leeway time.Duration,
+	tokenTTL time.Duration,
+	maxAppTokenTTL time.Duration,
+	refreshTTL time.Duration,
+	rememberMeTTL time.Duration,
+	resetTTL time.Duration,
+	revokeOnPasswordChange bool,
+	maxLoginAttempts int,
+	lockoutDuration time.Duration,
+	minLoginDuration time.Duration,
+	totpKey []byte,
+	verifyTTL time.Duration,
+	requireEmailVerification bool,
+	passwordPolicy PasswordPolicy,
+	strictEmails bool,
+	bcryptCost int,
+	hasher PasswordHasher,
+	limiter RateLimiter,
+	clock jwt.Clock,
+	tracer Tracer,
+	hooks Hooks,
+	redactEmails bool,
+) *Auth {
+	a, err := NewWithOptions(Config{
+		Log:                      log,
+		UserSaver:                userSaver,
+		UserProvider:             userProvider,
+		AppProvider:              appProvider,
+		AppSaver:                 appSaver,
+		RefreshStore:             refreshStore,
+		TokenRevoker:             tokenRevoker,
+		ResetStore:               resetStore,
+		Attempts:                 attempts,
+		TOTPStore:                totpStore,
+		Roles:                    roles,
+		VerifyStore:              verifyStore,
+		AuditLog:                 auditLog,
+		Sessions:                 sessions,
+		Keys:                     keys,
+		Issuer:                   issuer,
+		Leeway:                   leeway,
+		TokenTTL:                 tokenTTL,
+		MaxAppTokenTTL:           maxAppTokenTTL,
+		RefreshTTL:               refreshTTL,
+		RememberMeTTL:            rememberMeTTL,
+		ResetTTL:                 resetTTL,
+		VerifyTTL:                verifyTTL,
+		RevokeOnPasswordChange:   revokeOnPasswordChange,
+		MaxLoginAttempts:         maxLoginAttempts,
+		LockoutDuration:          lockoutDuration,
+		MinLoginDuration:         minLoginDuration,
+		TOTPKey:                  totpKey,
+		RequireEmailVerification: requireEmailVerification,
+		PasswordPolicy:           passwordPolicy,
+		StrictEmails:             strictEmails,
+		BcryptCost:               bcryptCost,
+		Hasher:                   hasher,
+		Limiter:                  limiter,
+		Clock:                    clock,
+		Tracer:                   tracer,
+		Hooks:                    hooks,
+		RedactEmails:             redactEmails,
+	})
+	if err != nil {
+		panic(err)
 	}
+
+	return a
 }
 
-// Login authenticates a user and returns a token for the given app ID.
+// Login authenticates a user and returns a token for the given app ID. It is
+// a shorthand for LoginV2 without a refresh token. The identifier is either
+// the user's email or, if it contains no "@", their username.
 //
-// The method returns ErrUserNotFound if the user is not found, ErrInvalidPassword
-// if the password is invalid, or ErrInternal if an internal error occurs.
-func (a *Auth) Login(ctx context.Context, email, password string, appID int) (token string, err error) {
-	const op = "auth.Login"
+// The method returns ErrInvalidAppID if appID isn't positive, ErrUserNotFound if
+// the user is not found, ErrInvalidPassword if the password is invalid, or
+// ErrInternal if an internal error occurs.
+func (a *Auth) Login(ctx context.Context, identifier, password string, appID int) (token string, err error) {
+	res, err := a.login(ctx, "auth.Login", identifier, password, appID, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return res.AccessToken, nil
+}
+
+// LoginV2 authenticates a user like Login and returns the access token along
+// with its expiry, the user ID and a refresh token, so clients can schedule
+// refreshes without decoding the token.
+func (a *Auth) LoginV2(ctx context.Context, identifier, password string, appID int) (models.LoginResult, error) {
+	return a.login(ctx, "auth.LoginV2", identifier, password, appID, a.refreshTTL)
+}
+
+// LoginOptions tweaks the session LoginWithOptions starts.
+type LoginOptions struct {
+	// RememberMe issues the refresh token with the extended remember me TTL
+	// instead of the standard one, for "keep me signed in" logins.
+	RememberMe bool
+}
+
+// LoginWithOptions authenticates a user like LoginV2, with the session
+// shaped by opts.
+func (a *Auth) LoginWithOptions(ctx context.Context, identifier, password string, appID int, opts LoginOptions) (models.LoginResult, error) {
+	refreshTTL := a.refreshTTL
+	if opts.RememberMe && a.rememberMeTTL > 0 {
+		refreshTTL = a.rememberMeTTL
+	}
+
+	return a.login(ctx, "auth.LoginWithOptions", identifier, password, appID, refreshTTL)
+}
+
+// login authenticates a user and issues an access token for the given app,
+// plus a refresh token valid for refreshTTL if it is positive.
+func (a *Auth) login(ctx context.Context, op, identifier, password string, appID int, refreshTTL time.Duration) (res models.LoginResult, err error) {
+	defer a.padLogin(ctx, time.Now())
+
+	ctx, end := a.startSpan(ctx, op)
+	defer end(&err)
 
-	log := a.log.With(slog.String("op", op), slog.String("username", email))
+	log := a.opLogger(ctx, op, a.identifierAttr(identifier))
 
 	log.Info("attempting to login user")
 
-	user, err := a.userProvider.User(ctx, email)
+	user, app, amr, err := a.authenticate(ctx, identifier, password, "", appID)
 	if err != nil {
+		a.recordLoginFailure(ctx, err)
+
+		return models.LoginResult{}, opError(op, err)
+	}
+
+	fingerprint, err := a.loginFingerprint(ctx, user, app)
+	if err != nil {
+		return models.LoginResult{}, opError(op, err)
+	}
+
+	res.UserID = user.ID
+	res.PasswordChangeRequired = user.MustChangePassword
+
+	sessionID, err := a.startSession(ctx, user.ID, app.ID)
+	if err != nil {
+		log.Error("failed to start session", slog.String("error", err.Error()))
+
+		return models.LoginResult{}, opError(op, err)
+	}
+
+	res.AccessToken, res.ExpiresAt, err = a.newToken(ctx, user, app, sessionID, amr, fingerprint)
+	if err != nil {
+		log.Error("failed to create token", slog.String("error", err.Error()))
+
+		return models.LoginResult{}, opError(op, err)
+	}
+
+	// Temporary passwords shouldn't grant long-lived access, so the limited
+	// token issued for them comes without a refresh token.
+	if refreshTTL > 0 && !user.MustChangePassword {
+		res.RefreshToken, err = a.issueRefreshToken(ctx, user.ID, app.ID, sessionID, refreshTTL, amr, fingerprint)
+		if err != nil {
+			log.Error("failed to issue refresh token", slog.String("error", err.Error()))
+
+			return models.LoginResult{}, opError(op, err)
+		}
+	}
+
+	// The event is only written once the login has gone through, so that
+	// none is published for a login failing to issue its tokens.
+	if err := a.saveOutboxEvent(ctx, models.OutboxEventLogin, user.ID, loginPayload{AppID: app.ID}); err != nil {
+		log.Error("failed to save outbox event", slog.String("error", err.Error()))
+
+		return models.LoginResult{}, opError(op, err)
+	}
+
+	log.Info("user logged in successfully")
+
+	a.recordEvent(ctx, models.AuthEventLogin, user.ID, "")
+	a.onLogin(ctx, user.ID, app.ID)
+
+	return res, nil
+}
+
+// newToken issues an access token for the user and app in the given session,
+// embedding the user's roles, the scopes granted through them and the
+// authentication methods amr, and returns it with its expiry. Tokens are
+// signed with the app's signing algorithm, see jwt.SigningAlg. A non-empty
+// fingerprint binds the token to the client it identifies.
+//
+// Users who must change their password get a limited token instead, without
+// roles and with ScopePasswordChange as its only scope, so that relying
+// parties only let them change it.
+func (a *Auth) newToken(ctx context.Context, user models.User, app models.App, sessionID string, amr []string, fingerprint string) (string, time.Time, error) {
+	if user.MustChangePassword {
+		return a.signToken(user, app, nil, []string{models.ScopePasswordChange}, amr, sessionID, fingerprint)
+	}
+
+	spanCtx, end := a.startSpan(ctx, "storage.UserRoles")
+	roles, err := a.roles.UserRoles(spanCtx, user.ID)
+	end(&err)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	spanCtx, end = a.startSpan(ctx, "storage.UserScopes")
+	scopes, err := a.roles.UserScopes(spanCtx, user.ID)
+	end(&err)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get user scopes: %w", err)
+	}
+
+	return a.signToken(user, app, roles, scopes, amr, sessionID, fingerprint)
+}
+
+// signToken signs an access token for the app's TTL and returns it with its
+// expiry.
+func (a *Auth) signToken(user models.User, app models.App, roles, scopes, amr []string, sessionID, fingerprint string) (string, time.Time, error) {
+	now := a.clock.Now()
+	ttl := a.appTokenTTL(app)
+
+	token, err := jwt.NewToken(user, app, ttl, a.keys, roles, scopes, amr, sessionID, fingerprint, a.issuer, a.leeway, jwt.FixedClock(now))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// The exp claim has a one-second resolution.
+	return token, time.Unix(now.Add(ttl).Unix(), 0), nil
+}
+
+// appTokenTTL returns the access token TTL for the app: its own TTL if set,
+// capped at maxAppTokenTTL, or the global tokenTTL otherwise.
+func (a *Auth) appTokenTTL(app models.App) time.Duration {
+	if app.TokenTTL <= 0 {
+		return a.tokenTTL
+	}
+
+	if a.maxAppTokenTTL > 0 && app.TokenTTL > a.maxAppTokenTTL {
+		return a.maxAppTokenTTL
+	}
+
+	return app.TokenTTL
+}
+
+// authenticate checks the user's credentials and resolves the app they are
+// logging in to, returning the methods the user authenticated with for the
+// amr claim. For users with two-factor authentication enabled, totpCode must
+// hold a valid code.
+//
+// It returns ErrRateLimited if the caller exceeded the login rate limit,
+// ErrAccountLocked while the account is locked out after too many failed
+// attempts, ErrTOTPRequired if the user has two-factor authentication enabled
+// but no code was given, and ErrEmailNotVerified if email verification is
+// required and the user hasn't verified theirs. Non-positive app IDs are
+// rejected with ErrInvalidAppID before any lookup.
+func (a *Auth) authenticate(ctx context.Context, identifier, password, totpCode string, appID int) (models.User, models.App, []string, error) {
+	if appID <= 0 {
+		a.log.Warn("invalid app id", slog.Int("app_id", appID))
+
+		return models.User{}, models.App{}, nil, ErrInvalidAppID
+	}
+
+	identifier = normalizeIdentifier(identifier)
+
+	// The identifier is reported as the email field, which also accepts
+	// usernames.
+	v := a.newValidator()
+	v.identifier("email", identifier)
+	v.password("password", password)
+	if err := v.err(); err != nil {
+		a.log.Warn("invalid login request", slog.String("error", err.Error()))
+
+		return models.User{}, models.App{}, nil, err
+	}
+
+	if err := a.checkRateLimit(ctx); err != nil {
+		return models.User{}, models.App{}, nil, err
+	}
+
+	user, err := a.lookupUser(ctx, identifier)
+
+	// Failed logins are counted per email, so that alternating between the
+	// email and the username doesn't double the attempts before a lockout.
+	email := identifier
+	if err == nil {
+		email = user.Email
+	}
+
+	if err := a.checkLockout(ctx, email); err != nil {
+		return models.User{}, models.App{}, nil, err
+	}
+
+	if err != nil {
+		reason := reasonLookupFailed
 		if errors.Is(err, storage.ErrUserNotFound) {
-			a.log.Warn("user not found", slog.String("error", err.Error()))
+			reason = reasonUserNotFound
+
+			spanCtx, end := a.startSpan(ctx, "password.Compare")
+			cmpErr := comparePassword(spanCtx, a.dummyHash, password)
+			end(&cmpErr)
 		}
 
-		return "", fmt.Errorf("%s: %w", op, storage.ErrInvalidCredentials)
+		if err := a.recordFailedLogin(ctx, email); err != nil {
+			return models.User{}, models.App{}, nil, err
+		}
+
+		return models.User{}, models.App{}, nil, a.credentialsFailure(ctx, reason, 0, err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		a.log.Warn("invalid credentials", slog.String("error", err.Error()))
+	spanCtx, end := a.startSpan(ctx, "password.Compare")
+	err = comparePassword(spanCtx, user.PassHash, password)
+	end(&err)
+	if err != nil {
+		if isContextError(err) {
+			return models.User{}, models.App{}, nil, err
+		}
 
-		return "", fmt.Errorf("%s: %w", op, storage.ErrInvalidCredentials)
+		if err := a.recordFailedLogin(ctx, email); err != nil {
+			return models.User{}, models.App{}, nil, err
+		}
+
+		return models.User{}, models.App{}, nil, a.credentialsFailure(ctx, reasonInvalidPassword, user.ID, err)
 	}
 
-	app, err := a.appProvider.App(ctx, appID)
+	a.upgradePasswordHash(ctx, user, password)
+
+	otpVerified, err := a.verifyTOTP(ctx, user, totpCode)
 	if err != nil {
-		if errors.Is(err, storage.ErrAppNotFound) {
-			a.log.Warn("app not found", slog.String("error", err.Error()))
+		if errors.Is(err, ErrInvalidTOTPCode) {
+			if err := a.recordFailedLogin(ctx, email); err != nil {
+				return models.User{}, models.App{}, nil, err
+			}
 		}
 
-		return "", fmt.Errorf("%s: %w", op, storage.ErrInvalidCredentials)
+		return models.User{}, models.App{}, nil, err
 	}
 
-	log.Info("user logged in successfully")
+	amr := []string{jwt.AMRPassword}
+	if otpVerified {
+		amr = append(amr, jwt.AMROTP)
+	}
+
+	if err := a.resetFailedLogins(ctx, email); err != nil {
+		return models.User{}, models.App{}, nil, err
+	}
+
+	// Checked only once the credentials are known to be right, so that the
+	// account's state isn't revealed to anyone else.
+	if !user.IsActive {
+		a.log.Warn("account disabled", slog.Int64("user_id", user.ID))
 
-	token, err = jwt.NewToken(user, app, a.tokenTTL)
+		return models.User{}, models.App{}, nil, ErrAccountDisabled
+	}
+
+	if a.requireEmailVerification && !user.IsVerified {
+		a.log.Warn("email not verified", slog.Int64("user_id", user.ID))
+
+		return models.User{}, models.App{}, nil, ErrEmailNotVerified
+	}
+
+	spanCtx, end = a.startSpan(ctx, "storage.App")
+	app, err := a.appProvider.App(spanCtx, appID)
+	end(&err)
 	if err != nil {
-		a.log.Error("failed to create token", slog.String("error", err.Error()))
+		reason := reasonLookupFailed
+		if errors.Is(err, storage.ErrAppNotFound) {
+			reason = reasonAppNotFound
+		}
+
+		return models.User{}, models.App{}, nil, a.credentialsFailure(ctx, reason, user.ID, err)
+	}
+
+	return user, app, amr, nil
+}
+
+// lookupUser returns the user with the given email or, if identifier contains
+// no "@", username.
+func (a *Auth) lookupUser(ctx context.Context, identifier string) (user models.User, err error) {
+	if isEmail(identifier) {
+		ctx, end := a.startSpan(ctx, "storage.User")
+		defer end(&err)
+
+		return a.userProvider.User(ctx, identifier)
+	}
+
+	ctx, end := a.startSpan(ctx, "storage.UserByUsername")
+	defer end(&err)
+
+	return a.userProvider.UserByUsername(ctx, identifier)
+}
+
+// Reasons a login is rejected with ErrInvalidCredentials. They are only
+// visible in logs and metrics, never to callers.
+const (
+	reasonUserNotFound    = "user_not_found"
+	reasonInvalidPassword = "invalid_password"
+	reasonAppNotFound     = "app_not_found"
+	// reasonLookupFailed means the user or app couldn't be loaded for a
+	// reason other than not existing, e.g. the storage being down.
+	reasonLookupFailed = "lookup_failed"
+)
+
+// credentialsError is ErrInvalidCredentials annotated with the reason the
+// login was rejected, for metrics. Its message doesn't include the reason so
+// callers can't tell registered emails apart.
+type credentialsError struct {
+	reason string
+	// userID is the user whose credentials were rejected, if known.
+	userID int64
+}
+
+// credentialsFailure logs why a login was rejected and returns the uniform
+// ErrInvalidCredentials carrying the reason.
+func (a *Auth) credentialsFailure(ctx context.Context, reason string, userID int64, err error) error {
+	level := slog.LevelWarn
+	if reason == reasonLookupFailed {
+		level = slog.LevelError
+	}
+
+	a.log.Log(ctx, level, "invalid credentials",
+		slog.String("reason", reason),
+		slog.String("error", err.Error()),
+	)
+
+	return credentialsError{reason: reason, userID: userID}
+}
 
-		return "", fmt.Errorf("%s: %w", op, err)
+func (e credentialsError) Error() string { return ErrInvalidCredentials.Error() }
+
+func (e credentialsError) Unwrap() error { return ErrInvalidCredentials }
+
+// emailAttr returns the log attribute for email, masked if email redaction
+// is enabled.
+func (a *Auth) emailAttr(key, email string) slog.Attr {
+	if a.redactEmails {
+		email = pii.MaskEmail(email)
 	}
 
-	return token, nil
+	return slog.String(key, email)
 }
 
 // RegisterNewUser creates a new user in the database with the given email and password.
+// The email is trimmed and lowercased, so that it matches regardless of case.
+// The user gets the configured default roles in the same transaction.
 //
-// The method returns ErrUserAlreadyExists if the user already exists, or ErrInternal
-// if an internal error occurs.
-func (a *Auth) RegisterNewUser(ctx context.Context, email, password string) (int64, error) {
-	const op = "auth.RegisterNewUser"
+// The method returns ErrWeakPassword if the password doesn't satisfy the password
+// policy, ErrUserAlreadyExists if the user already exists, or ErrInternal if an
+// internal error occurs.
+func (a *Auth) RegisterNewUser(ctx context.Context, email, password string) (userID int64, err error) {
+	return a.registerNewUser(ctx, "auth.RegisterNewUser", email, "", password)
+}
 
-	log := a.log.With(slog.String("op", op), slog.String("email", email))
+// RegisterNewUserWithUsername registers a user like RegisterNewUser, who can
+// also log in with the given username.
+//
+// The method additionally returns ErrInvalidUsername if the username isn't
+// 3 to 32 letters, digits, dots, dashes or underscores, and ErrUsernameTaken
+// if another user has it.
+func (a *Auth) RegisterNewUserWithUsername(ctx context.Context, email, username, password string) (userID int64, err error) {
+	return a.registerNewUser(ctx, "auth.RegisterNewUserWithUsername", email, username, password)
+}
+
+func (a *Auth) registerNewUser(ctx context.Context, op, email, username, password string) (userID int64, err error) {
+	ctx, end := a.startSpan(ctx, op)
+	defer end(&err)
+
+	email = normalizeEmail(email)
+
+	log := a.opLogger(ctx, op, a.emailAttr("email", email), slog.String("username", username))
 
 	log.Info("registering new user")
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	v := a.newValidator()
+	v.email("email", email)
+	v.password("password", password)
+	if err := v.err(); err != nil {
+		log.Warn("invalid registration request", slog.String("error", err.Error()))
+
+		return 0, opError(op, err)
+	}
+
+	if username != "" && !validUsername(username) {
+		log.Warn("invalid username")
+
+		return 0, opError(op, ErrInvalidUsername)
+	}
+
+	if err := a.passwordPolicy.Validate(password); err != nil {
+		log.Warn("weak password", slog.String("error", err.Error()))
+
+		return 0, opError(op, err)
+	}
+
+	spanCtx, endHash := a.startSpan(ctx, "password.Hash")
+	passHash, err := hashPassword(spanCtx, a.hasher, password)
+	endHash(&err)
 	if err != nil {
 		log.Error("failed to hash password", slog.String("error", err.Error()))
 
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return 0, opError(op, err)
+	}
+
+	events, err := a.registrationEvents(email, username)
+	if err != nil {
+		log.Error("failed to create outbox events", slog.String("error", err.Error()))
+
+		return 0, opError(op, err)
+	}
+
+	var firstUserRoles []string
+	if a.bootstrapFirstAdmin {
+		firstUserRoles = []string{models.RoleAdmin}
 	}
 
-	id, err := a.userSaver.SaveUser(ctx, email, passHash)
+	spanCtx, endSave := a.startSpan(ctx, "storage.SaveUser")
+	id, err := a.userSaver.SaveUser(spanCtx, email, username, passHash, a.defaultRoles, firstUserRoles, events)
+	endSave(&err)
 	if err != nil {
 		log.Error("failed to save user", slog.String("error", err.Error()))
 
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return 0, opError(op, err)
 	}
 
 	log.Info("user registered")
 
+	a.onRegister(ctx, id, email)
+
 	return id, nil
 }
 
-// IsAdmin checks whether the given user is an admin or not.
+// IsAdmin checks whether the given user has the admin role.
 //
-// The method returns true if the user is an admin, false otherwise, and an error
-// if an internal error occurs.
-func (a *Auth) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+// The method returns true if the user is an admin, false otherwise,
+// ErrInvalidUserID if userID isn't positive, ErrUserNotFound if the user
+// doesn't exist or has been deleted, and an error if an internal error
+// occurs.
+func (a *Auth) IsAdmin(ctx context.Context, userID int64) (isAdmin bool, err error) {
 	const op = "auth.IsAdmin"
 
-	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+	ctx, end := a.startSpan(ctx, op)
+	defer end(&err)
+
+	log := a.opLogger(ctx, op, slog.Int64("user_id", userID))
 
 	log.Info("checking if is admin")
 
-	isAdmin, err := a.userProvider.IsAdmin(ctx, userID)
+	if userID <= 0 {
+		log.Warn("invalid user id")
+
+		return false, opError(op, ErrInvalidUserID)
+	}
+
+	spanCtx, endIsAdmin := a.startSpan(ctx, "storage.IsAdmin")
+	isAdmin, err = a.userProvider.IsAdmin(spanCtx, userID)
+	endIsAdmin(&err)
 	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return false, opError(op, ErrUserNotFound)
+		}
+
 		log.Error("failed to check if is admin", slog.String("error", err.Error()))
 
-		return false, fmt.Errorf("%s: %w", op, err)
+		return false, opError(op, err)
 	}
 
 	log.Info("checked if is admin", slog.Bool("is_admin", isAdmin))
 
 	return isAdmin, nil
 }
+
+// ValidateToken verifies a token issued by Login and returns its claims.
+//
+// The method returns ErrTokenExpired if the token is past its TTL, ErrTokenRevoked
+// if it has been revoked via Logout, ErrFingerprintMismatch if it is bound to
+// another client, or ErrInvalidToken if the token is malformed or its signature
+// doesn't match.
+func (a *Auth) ValidateToken(ctx context.Context, token string) (models.TokenClaims, error) {
+	return a.validateToken(ctx, token, true)
+}
+
+// validateToken validates a token like ValidateToken, checking that it is
+// presented by the client it is bound to only if checkBinding is set.
+func (a *Auth) validateToken(ctx context.Context, token string, checkBinding bool) (models.TokenClaims, error) {
+	const op = "auth.ValidateToken"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("validating token")
+
+	claims, err := jwt.ParseToken(token, func(appID int) ([]string, error) {
+		app, err := a.appProvider.App(ctx, appID)
+		if err != nil {
+			return nil, err
+		}
+
+		// The app knows its own secret, so it could forge HS256 tokens
+		// that would otherwise pass for the RS256 ones issued to it.
+		if jwt.SigningAlg(app, a.keys) == jwt.AlgRS256 {
+			return nil, fmt.Errorf("app %d only accepts RS256 tokens", appID)
+		}
+
+		return append([]string{app.Secret}, app.PreviousSecrets...), nil
+	}, a.keys, a.issuer, a.leeway, a.clock)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			log.Warn("token expired", slog.String("error", err.Error()))
+
+			return models.TokenClaims{}, opError(op, ErrTokenExpired)
+		}
+
+		log.Warn("invalid token", slog.String("error", err.Error()))
+
+		return models.TokenClaims{}, opError(op, ErrInvalidToken)
+	}
+
+	if checkBinding {
+		if err := checkFingerprint(ctx, claims.Fingerprint); err != nil {
+			log.Warn("token presented by another client", slog.Int64("user_id", claims.UserID))
+
+			return models.TokenClaims{}, opError(op, err)
+		}
+	}
+
+	if err := a.checkSession(ctx, claims.SessionID); err != nil {
+		if errors.Is(err, ErrTokenRevoked) {
+			log.Warn("session revoked", slog.String("sid", claims.SessionID))
+		} else {
+			log.Error("failed to check session", slog.String("error", err.Error()))
+		}
+
+		return models.TokenClaims{}, opError(op, err)
+	}
+
+	if claims.UserID != 0 && (a.sessions == nil || claims.SessionID == "") {
+		if err := a.checkTokensRevoked(ctx, claims); err != nil {
+			if errors.Is(err, ErrTokenRevoked) {
+				log.Warn("user tokens revoked", slog.Int64("user_id", claims.UserID))
+			} else {
+				log.Error("failed to check user tokens revocation", slog.String("error", err.Error()))
+			}
+
+			return models.TokenClaims{}, opError(op, err)
+		}
+	}
+
+	if claims.ID != "" {
+		revoked, err := a.tokenRevoker.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			log.Error("failed to check token revocation", slog.String("error", err.Error()))
+
+			return models.TokenClaims{}, opError(op, err)
+		}
+
+		if revoked {
+			log.Warn("token revoked", slog.String("jti", claims.ID))
+
+			return models.TokenClaims{}, opError(op, ErrTokenRevoked)
+		}
+	}
+
+	log.Info("token validated", slog.Int64("user_id", claims.UserID))
+
+	return claims, nil
+}
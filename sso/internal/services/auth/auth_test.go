@@ -0,0 +1,87 @@
+package auth_test
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sso/internal/migrator"
+	"sso/internal/services/auth"
+	"sso/internal/storage"
+	"sso/internal/storage/sqlite"
+	"testing"
+	"time"
+)
+
+const (
+	testEmail    = "user@example.com"
+	testPassword = "correct-horse-1"
+	// testAppID is the app created by the migrations.
+	testAppID = 1
+)
+
+// newTestStorage returns a SQLite storage backed by a freshly migrated
+// database in the test's temporary directory.
+func newTestStorage(t testing.TB) *sqlite.Storage {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sso.db")
+
+	if err := migrator.RunMigrations(migrator.DriverSQLite, path, "../../../migrations", "", sqlite.Options{}, migrator.Up); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	s, err := sqlite.New(path, storage.PoolConfig{}, sqlite.Options{}, storage.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+// newTestAuth returns an Auth service on top of s, with the settings a test
+// needs applied by configure, if not nil.
+func newTestAuth(t testing.TB, s *sqlite.Storage, configure func(*auth.Config)) *auth.Auth {
+	t.Helper()
+
+	cfg := auth.Config{
+		Log:          slog.New(slog.DiscardHandler),
+		UserSaver:    s,
+		UserProvider: s,
+		AppProvider:  s,
+		AppSaver:     s,
+		RefreshStore: s,
+		TokenRevoker: s,
+		ResetStore:   s,
+		Attempts:     s,
+		TOTPStore:    s,
+		Roles:        s,
+		VerifyStore:  s,
+		TokenTTL:     time.Hour,
+		RefreshTTL:   24 * time.Hour,
+		BcryptCost:   4,
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	a, err := auth.NewWithOptions(cfg)
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+
+	return a
+}
+
+// registerUser registers a user with testPassword and returns their ID.
+func registerUser(t testing.TB, a *auth.Auth, email string) int64 {
+	t.Helper()
+
+	userID, err := a.RegisterNewUser(context.Background(), email, testPassword)
+	if err != nil {
+		t.Fatalf("failed to register %s: %v", email, err)
+	}
+
+	return userID
+}
@@ -0,0 +1,125 @@
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/services/auth"
+	"sso/internal/storage/inmemory"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	benchEmail    = "user@example.com"
+	benchPassword = "correct-horse-1"
+)
+
+// benchCosts are the bcrypt cost factors the benchmarks run with.
+var benchCosts = []int{bcrypt.MinCost, bcrypt.DefaultCost, 12}
+
+// benchStorage serves the users and apps from an in-memory storage and stubs
+// out the rest, so the benchmarks measure hashing rather than a database.
+// The embedded interfaces are nil: the benchmarks panic if the paths they
+// cover ever start using a method not stubbed below.
+type benchStorage struct {
+	*inmemory.Storage
+	auth.AppSaver
+	auth.RefreshTokenStorage
+	auth.TokenRevoker
+	auth.PasswordResetStorage
+	auth.LoginAttemptsStorage
+	auth.TOTPStorage
+	auth.RoleStorage
+	auth.EmailVerificationStorage
+}
+
+func (benchStorage) SaveRefreshToken(context.Context, models.RefreshToken) error {
+	return nil
+}
+
+func (benchStorage) TOTPSecret(context.Context, int64) ([]byte, error) {
+	return nil, nil
+}
+
+func (benchStorage) UserRoles(context.Context, int64) ([]string, error) {
+	return nil, nil
+}
+
+func (benchStorage) UserScopes(context.Context, int64) ([]string, error) {
+	return nil, nil
+}
+
+func newBenchAuth(b *testing.B, cost int) (*auth.Auth, int) {
+	b.Helper()
+
+	s := benchStorage{Storage: inmemory.New()}
+	appID := s.SeedApp(models.App{Name: "bench", Secret: "bench-secret"})
+
+	a, err := auth.NewWithOptions(auth.Config{
+		Log:          slog.New(slog.DiscardHandler),
+		UserSaver:    s,
+		UserProvider: s,
+		AppProvider:  s,
+		AppSaver:     s,
+		RefreshStore: s,
+		TokenRevoker: s,
+		ResetStore:   s,
+		Attempts:     s,
+		TOTPStore:    s,
+		Roles:        s,
+		VerifyStore:  s,
+		TokenTTL:     time.Hour,
+		RefreshTTL:   24 * time.Hour,
+		BcryptCost:   cost,
+	})
+	if err != nil {
+		b.Fatalf("failed to create auth service: %v", err)
+	}
+
+	return a, appID
+}
+
+func BenchmarkLogin(b *testing.B) {
+	for _, cost := range benchCosts {
+		b.Run(fmt.Sprintf("cost=%d", cost), func(b *testing.B) {
+			a, appID := newBenchAuth(b, cost)
+			ctx := context.Background()
+
+			if _, err := a.RegisterNewUser(ctx, benchEmail, benchPassword); err != nil {
+				b.Fatalf("failed to register user: %v", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for range b.N {
+				if _, err := a.Login(ctx, benchEmail, benchPassword, appID); err != nil {
+					b.Fatalf("Login() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRegister(b *testing.B) {
+	for _, cost := range benchCosts {
+		b.Run(fmt.Sprintf("cost=%d", cost), func(b *testing.B) {
+			a, _ := newBenchAuth(b, cost)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := range b.N {
+				email := fmt.Sprintf("user%d@example.com", i)
+				if _, err := a.RegisterNewUser(ctx, email, benchPassword); err != nil {
+					b.Fatalf("RegisterNewUser() error = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/requestmeta"
+)
+
+// tokenFingerprint returns the client fingerprint the app's tokens are bound
+// to, empty if the app doesn't bind tokens.
+//
+// It returns ErrFingerprintRequired if the app binds tokens but the request
+// carries no fingerprint.
+func (a *Auth) tokenFingerprint(ctx context.Context, app models.App) (string, error) {
+	if !app.BindTokens {
+		return "", nil
+	}
+
+	fingerprint := requestmeta.FromContext(ctx).Fingerprint
+	if fingerprint == "" {
+		return "", ErrFingerprintRequired
+	}
+
+	return fingerprint, nil
+}
+
+// loginFingerprint returns the fingerprint to bind the tokens of the user's
+// login to the app with, like tokenFingerprint. A login refused for lacking
+// one is audited as failed, and must be refused before it has any other
+// effect.
+func (a *Auth) loginFingerprint(ctx context.Context, user models.User, app models.App) (string, error) {
+	fingerprint, err := a.tokenFingerprint(ctx, app)
+	if err != nil {
+		a.log.Warn("client fingerprint required", slog.Int64("user_id", user.ID), slog.Int("app_id", app.ID))
+
+		a.recordEvent(ctx, models.AuthEventLoginFailed, user.ID, failureReason(err))
+
+		return "", err
+	}
+
+	return fingerprint, nil
+}
+
+// checkFingerprint returns ErrFingerprintMismatch if a token bound to
+// fingerprint is presented by another client. Unbound tokens pass.
+func checkFingerprint(ctx context.Context, fingerprint string) error {
+	if fingerprint == "" {
+		return nil
+	}
+
+	presented := requestmeta.FromContext(ctx).Fingerprint
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(fingerprint)) != 1 {
+		return ErrFingerprintMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"sso/internal/domain/models"
+	"sso/internal/lib/requestmeta"
+	"sso/internal/services/auth"
+	"testing"
+)
+
+func TestLoginToBindingApp(t *testing.T) {
+	s := newTestStorage(t)
+	a := newTestAuth(t, s, func(cfg *auth.Config) {
+		cfg.AuditLog = s
+		cfg.Outbox = s
+	})
+
+	if err := s.UpdateAppTokenBinding(context.Background(), testAppID, true); err != nil {
+		t.Fatalf("failed to bind tokens: %v", err)
+	}
+
+	userID := registerUser(t, a, testEmail)
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		wantErr     error
+		wantEvent   string
+	}{
+		{name: "without fingerprint", wantErr: auth.ErrFingerprintRequired, wantEvent: models.AuthEventLoginFailed},
+		{name: "with fingerprint", fingerprint: "device-1", wantEvent: models.AuthEventLogin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := requestmeta.WithMeta(context.Background(), requestmeta.Meta{Fingerprint: tt.fingerprint})
+
+			pending, err := s.PendingOutboxEvents(ctx, 100)
+			if err != nil {
+				t.Fatalf("failed to get outbox events: %v", err)
+			}
+
+			_, _, err = a.LoginWithRefresh(ctx, testEmail, testPassword, testAppID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoginWithRefresh() error = %v, want %v", err, tt.wantErr)
+			}
+
+			events, err := s.AuthEvents(ctx, userID, 1)
+			if err != nil {
+				t.Fatalf("failed to get audit events: %v", err)
+			}
+
+			if len(events) != 1 || events[0].Type != tt.wantEvent {
+				t.Fatalf("last audit event = %+v, want %s", events, tt.wantEvent)
+			}
+
+			after, err := s.PendingOutboxEvents(ctx, 100)
+			if err != nil {
+				t.Fatalf("failed to get outbox events: %v", err)
+			}
+
+			if published := len(after) > len(pending); published != (tt.wantErr == nil) {
+				t.Fatalf("outbox event written = %t, want %t", published, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestIntrospectBoundToken(t *testing.T) {
+	s := newTestStorage(t)
+	a := newTestAuth(t, s, nil)
+
+	if err := s.UpdateAppTokenBinding(context.Background(), testAppID, true); err != nil {
+		t.Fatalf("failed to bind tokens: %v", err)
+	}
+
+	userID := registerUser(t, a, testEmail)
+
+	clientCtx := requestmeta.WithMeta(context.Background(), requestmeta.Meta{Fingerprint: "device-1"})
+
+	token, err := a.Login(clientCtx, testEmail, testPassword, testAppID)
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+	}{
+		{name: "resource server without fingerprint"},
+		{name: "other fingerprint", fingerprint: "device-2"},
+		{name: "client fingerprint", fingerprint: "device-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := requestmeta.WithMeta(context.Background(), requestmeta.Meta{Fingerprint: tt.fingerprint})
+
+			res, err := a.Introspect(ctx, token)
+			if err != nil {
+				t.Fatalf("Introspect() error = %v", err)
+			}
+
+			if !res.Active || res.UserID != userID {
+				t.Fatalf("Introspect() = %+v, want an active token of user %d", res, userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sso/internal/storage"
+)
+
+// ErrorCode identifies an error returned by the Auth methods. Unlike error
+// messages, codes are stable and meant for machines, such as gateways mapping
+// them to responses.
+type ErrorCode string
+
+const (
+	// CodeInternal is reported for unexpected failures, details of which are
+	// only logged.
+	CodeInternal ErrorCode = "CODE_INTERNAL"
+	// CodeCanceled is reported when the context is canceled or times out.
+	CodeCanceled ErrorCode = "CODE_CANCELED"
+	// CodeInvalidArgument is reported for a *ValidationError.
+	CodeInvalidArgument ErrorCode = "CODE_INVALID_ARGUMENT"
+
+	CodeInvalidCredentials   ErrorCode = "CODE_INVALID_CREDENTIALS"
+	CodeInvalidToken         ErrorCode = "CODE_INVALID_TOKEN"
+	CodeTokenExpired         ErrorCode = "CODE_TOKEN_EXPIRED"
+	CodeTokenRevoked         ErrorCode = "CODE_TOKEN_REVOKED"
+	CodeRefreshTokenExpired  ErrorCode = "CODE_REFRESH_TOKEN_EXPIRED"
+	CodeRefreshTokenRevoked  ErrorCode = "CODE_REFRESH_TOKEN_REVOKED"
+	CodeTokenAppMismatch     ErrorCode = "CODE_TOKEN_APP_MISMATCH"
+	CodeFingerprintRequired  ErrorCode = "CODE_FINGERPRINT_REQUIRED"
+	CodeFingerprintMismatch  ErrorCode = "CODE_FINGERPRINT_MISMATCH"
+	CodeRateLimited          ErrorCode = "CODE_RATE_LIMITED"
+	CodePermissionDenied     ErrorCode = "CODE_PERMISSION_DENIED"
+	CodeAccountLocked        ErrorCode = "CODE_ACCOUNT_LOCKED"
+	CodeAccountDisabled      ErrorCode = "CODE_ACCOUNT_DISABLED"
+	CodeTOTPRequired         ErrorCode = "CODE_TOTP_REQUIRED"
+	CodeInvalidTOTPCode      ErrorCode = "CODE_INVALID_TOTP_CODE"
+	CodeTOTPNotConfigured    ErrorCode = "CODE_TOTP_NOT_CONFIGURED"
+	CodeMagicLinksDisabled   ErrorCode = "CODE_MAGIC_LINKS_DISABLED"
+	CodeInvalidRole          ErrorCode = "CODE_INVALID_ROLE"
+	CodeInvalidScope         ErrorCode = "CODE_INVALID_SCOPE"
+	CodeReservedClaim        ErrorCode = "CODE_RESERVED_CLAIM"
+	CodeEmailNotVerified     ErrorCode = "CODE_EMAIL_NOT_VERIFIED"
+	CodeWeakPassword         ErrorCode = "CODE_WEAK_PASSWORD"
+	CodePasswordTooLong      ErrorCode = "CODE_PASSWORD_TOO_LONG"
+	CodeSamePassword         ErrorCode = "CODE_SAME_PASSWORD"
+	CodeInvalidTokenTTL      ErrorCode = "CODE_INVALID_TOKEN_TTL"
+	CodeInvalidSigningAlg    ErrorCode = "CODE_INVALID_SIGNING_ALG"
+	CodeInvalidPasswordHash  ErrorCode = "CODE_INVALID_PASSWORD_HASH"
+	CodeInvalidUsername      ErrorCode = "CODE_INVALID_USERNAME"
+	CodeInvalidAppID         ErrorCode = "CODE_INVALID_APP_ID"
+	CodeInvalidUserID        ErrorCode = "CODE_INVALID_USER_ID"
+	CodeUserExists           ErrorCode = "CODE_USER_EXISTS"
+	CodeUserNotFound         ErrorCode = "CODE_USER_NOT_FOUND"
+	CodeAppExists            ErrorCode = "CODE_APP_EXISTS"
+	CodeAppNotFound          ErrorCode = "CODE_APP_NOT_FOUND"
+	CodeRefreshTokenNotFound ErrorCode = "CODE_REFRESH_TOKEN_NOT_FOUND"
+	CodeInvalidResetToken    ErrorCode = "CODE_INVALID_RESET_TOKEN"
+	CodeInvalidVerification  ErrorCode = "CODE_INVALID_VERIFICATION"
+	CodeInvalidMagicLink     ErrorCode = "CODE_INVALID_MAGIC_LINK"
+	CodeUnavailable          ErrorCode = "CODE_UNAVAILABLE"
+	CodeUsernameTaken        ErrorCode = "CODE_USERNAME_TAKEN"
+	CodeSessionNotFound      ErrorCode = "CODE_SESSION_NOT_FOUND"
+)
+
+// Error is an error carrying an ErrorCode. The errors defined by the package
+// are *Error values, which Code finds however they are wrapped.
+type Error struct {
+	Code ErrorCode
+	msg  string
+}
+
+func newError(code ErrorCode, msg string) *Error {
+	return &Error{Code: code, msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Errors returned by the Auth methods, to be matched with errors.Is.
+var (
+	ErrInvalidCredentials  = newError(CodeInvalidCredentials, "invalid credentials")
+	ErrInvalidToken        = newError(CodeInvalidToken, "invalid token")
+	ErrTokenExpired        = newError(CodeTokenExpired, "token expired")
+	ErrTokenRevoked        = newError(CodeTokenRevoked, "token revoked")
+	ErrRefreshTokenExpired = newError(CodeRefreshTokenExpired, "refresh token expired")
+	ErrRefreshTokenRevoked = newError(CodeRefreshTokenRevoked, "refresh token revoked")
+	ErrTokenAppMismatch    = newError(CodeTokenAppMismatch, "token was issued for another app")
+	ErrFingerprintRequired = newError(CodeFingerprintRequired, "client fingerprint required")
+	ErrFingerprintMismatch = newError(CodeFingerprintMismatch, "token is bound to another client")
+	ErrRateLimited         = newError(CodeRateLimited, "too many requests")
+	ErrPermissionDenied    = newError(CodePermissionDenied, "permission denied")
+	ErrAccountLocked       = newError(CodeAccountLocked, "account is temporarily locked")
+	ErrAccountDisabled     = newError(CodeAccountDisabled, "account is disabled")
+	ErrTOTPRequired        = newError(CodeTOTPRequired, "totp code required")
+	ErrInvalidTOTPCode     = newError(CodeInvalidTOTPCode, "invalid totp code")
+	ErrTOTPNotConfigured   = newError(CodeTOTPNotConfigured, "totp encryption key is not configured")
+	ErrMagicLinksDisabled  = newError(CodeMagicLinksDisabled, "magic links are disabled")
+	ErrInvalidRole         = newError(CodeInvalidRole, "invalid role")
+	ErrInvalidScope        = newError(CodeInvalidScope, "invalid scope")
+	ErrReservedClaim       = newError(CodeReservedClaim, "claim is reserved")
+	ErrEmailNotVerified    = newError(CodeEmailNotVerified, "email is not verified")
+	ErrWeakPassword        = newError(CodeWeakPassword, "password is too weak")
+	ErrPasswordTooLong     = newError(CodePasswordTooLong, "password is too long")
+	ErrSamePassword        = newError(CodeSamePassword, "new password must differ from the old one")
+	ErrInvalidTokenTTL     = newError(CodeInvalidTokenTTL, "invalid token ttl")
+	ErrInvalidSigningAlg   = newError(CodeInvalidSigningAlg, "invalid signing algorithm")
+	ErrInvalidPasswordHash = newError(CodeInvalidPasswordHash, "invalid password hash")
+	ErrInvalidUsername     = newError(CodeInvalidUsername, "invalid username")
+	ErrInvalidAppID        = newError(CodeInvalidAppID, "app id must be positive")
+	ErrInvalidUserID       = newError(CodeInvalidUserID, "user id must be positive")
+
+	// Errors reported by the storage, exposed so that callers don't depend on
+	// the storage package.
+	ErrUserExists           = storage.ErrUserExists
+	ErrUserNotFound         = storage.ErrUserNotFound
+	ErrAppExists            = storage.ErrAppExists
+	ErrAppNotFound          = storage.ErrAppNotFound
+	ErrRefreshTokenNotFound = storage.ErrRefreshTokenNotFound
+	ErrInvalidResetToken    = storage.ErrInvalidResetToken
+	ErrInvalidVerification  = storage.ErrInvalidVerification
+	ErrInvalidMagicLink     = storage.ErrInvalidMagicLink
+	ErrUnavailable          = storage.ErrUnavailable
+	ErrUsernameTaken        = storage.ErrUsernameTaken
+	ErrSessionNotFound      = storage.ErrSessionNotFound
+)
+
+// OpError records the operation of the Auth service that failed, such as
+// "auth.Login", so that errors can be grouped by operation with errors.As.
+// It reads as "op: err" when printed.
+type OpError struct {
+	Op  string
+	Err error
+}
+
+func opError(op string, err error) error {
+	return &OpError{Op: op, Err: err}
+}
+
+func (e *OpError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Ops returns the operations recorded by the OpErrors in err's chain,
+// outermost first. A method failing in another one it calls yields both.
+func Ops(err error) []string {
+	var ops []string
+
+	for err != nil {
+		var opErr *OpError
+		if !errors.As(err, &opErr) {
+			break
+		}
+
+		ops = append(ops, opErr.Op)
+		err = opErr.Err
+	}
+
+	return ops
+}
+
+// storageCodes are the codes of the errors passed through from the storage,
+// which can't carry one themselves.
+var storageCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{ErrUserExists, CodeUserExists},
+	{ErrUserNotFound, CodeUserNotFound},
+	{ErrAppExists, CodeAppExists},
+	{ErrAppNotFound, CodeAppNotFound},
+	{ErrRefreshTokenNotFound, CodeRefreshTokenNotFound},
+	{ErrInvalidResetToken, CodeInvalidResetToken},
+	{ErrInvalidVerification, CodeInvalidVerification},
+	{ErrInvalidMagicLink, CodeInvalidMagicLink},
+	{ErrUnavailable, CodeUnavailable},
+	{ErrUsernameTaken, CodeUsernameTaken},
+	{ErrSessionNotFound, CodeSessionNotFound},
+}
+
+// Code returns the code of err, which is usually returned by an Auth method,
+// or an empty code if err is nil. Errors without a code of their own are
+// reported as CodeInternal.
+func Code(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return CodeInvalidArgument
+	}
+
+	for _, sc := range storageCodes {
+		if errors.Is(err, sc.err) {
+			return sc.code
+		}
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return CodeCanceled
+	}
+
+	return CodeInternal
+}
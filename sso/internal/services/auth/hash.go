@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/passhash"
+)
+
+// hashPassword runs hasher.Hash without blocking past the context deadline.
+// The hash keeps running in the background after the context is done, but
+// its result is discarded.
+func hashPassword(ctx context.Context, hasher PasswordHasher, password string) ([]byte, error) {
+	type result struct {
+		hash []byte
+		err  error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		hash, err := hasher.Hash(password)
+		done <- result{hash: hash, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-done:
+		return res.hash, res.err
+	}
+}
+
+// isContextError reports whether err comes from a cancelled or expired
+// context rather than from the password hashing itself.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// comparePassword checks password against hash with the algorithm that
+// produced the hash, without blocking past the context deadline. It returns
+// ctx.Err() if the context is done first.
+func comparePassword(ctx context.Context, hash []byte, password string) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- passhash.Compare(hash, password)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// newDummyHash returns a hash of a random password made by hasher, for
+// comparisons that must take as long as checking a real password.
+func newDummyHash(hasher PasswordHasher) []byte {
+	password := make([]byte, 16)
+	_, _ = rand.Read(password)
+
+	hash, err := hasher.Hash(hex.EncodeToString(password))
+	if err != nil {
+		panic(fmt.Sprintf("auth: failed to generate dummy password hash: %v", err))
+	}
+
+	return hash
+}
+
+type rehasher interface {
+	NeedsRehash(hash []byte) bool
+}
+
+// upgradePasswordHash re-hashes a correct password whose stored hash doesn't
+// match the configured hasher, such as a bcrypt hash of a lower cost or one
+// made by another algorithm. Failures are only logged, since the user has
+// already been authenticated.
+func (a *Auth) upgradePasswordHash(ctx context.Context, user models.User, password string) {
+	r, ok := a.hasher.(rehasher)
+	if !ok || !r.NeedsRehash(user.PassHash) {
+		return
+	}
+
+	log := a.log.With(slog.Int64("user_id", user.ID))
+
+	passHash, err := hashPassword(ctx, a.hasher, password)
+	if err != nil {
+		log.Warn("failed to rehash password", slog.String("error", err.Error()))
+
+		return
+	}
+
+	if err := a.userSaver.UpdatePassword(ctx, user.ID, passHash, user.MustChangePassword); err != nil {
+		log.Warn("failed to save rehashed password", slog.String("error", err.Error()))
+
+		return
+	}
+
+	log.Info("password hash upgraded",
+		slog.String("from", passhash.Algorithm(user.PassHash)),
+		slog.String("to", passhash.Algorithm(passHash)),
+	)
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/requestmeta"
+)
+
+// Hooks are callbacks run after successful auth operations, so that other
+// systems can react to them, say by sending a welcome email, without the
+// auth package knowing about them. Any of them may be nil.
+//
+// Hooks run in their own goroutine once the operation has succeeded, so they
+// neither delay nor fail it. Their context carries the request's values but
+// isn't cancelled with it. Panics in hooks are recovered and logged.
+type Hooks struct {
+	OnRegister       func(ctx context.Context, userID int64, email string)
+	OnLogin          func(ctx context.Context, userID int64, appID int)
+	OnPasswordChange func(ctx context.Context, userID int64)
+}
+
+func (a *Auth) onRegister(ctx context.Context, userID int64, email string) {
+	if hook := a.hooks.OnRegister; hook != nil {
+		a.runHook(ctx, "register", func(ctx context.Context) { hook(ctx, userID, email) })
+	}
+}
+
+// LoginNotifier tells users that their account was logged in to, say by a
+// webhook or an email. It decides per app whether and where to notify.
+type LoginNotifier interface {
+	NotifyLogin(ctx context.Context, notification models.LoginNotification) error
+}
+
+func (a *Auth) onLogin(ctx context.Context, userID int64, appID int) {
+	if hook := a.hooks.OnLogin; hook != nil {
+		a.runHook(ctx, "login", func(ctx context.Context) { hook(ctx, userID, appID) })
+	}
+
+	if notifier := a.loginNotifier; notifier != nil {
+		meta := requestmeta.FromContext(ctx)
+		notification := models.LoginNotification{
+			UserID:    userID,
+			AppID:     appID,
+			At:        a.clock.Now(),
+			IP:        meta.IP,
+			UserAgent: meta.UserAgent,
+		}
+
+		a.runHook(ctx, "login_notification", func(ctx context.Context) {
+			if err := notifier.NotifyLogin(ctx, notification); err != nil {
+				a.log.Warn("failed to send login notification",
+					slog.Int64("user_id", userID),
+					slog.String("error", err.Error()),
+				)
+			}
+		})
+	}
+}
+
+func (a *Auth) onPasswordChange(ctx context.Context, userID int64) {
+	if hook := a.hooks.OnPasswordChange; hook != nil {
+		a.runHook(ctx, "password_change", func(ctx context.Context) { hook(ctx, userID) })
+	}
+}
+
+func (a *Auth) runHook(ctx context.Context, name string, hook func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				a.log.Error("hook panicked",
+					slog.String("hook", name),
+					slog.String("error", fmt.Sprint(r)),
+				)
+			}
+		}()
+
+		hook(ctx)
+	}()
+}
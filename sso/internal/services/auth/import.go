@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/lib/passhash"
+)
+
+// ImportError reports a user ImportUsers could not import.
+type ImportError struct {
+	// Index is the position of the user in the imported batch.
+	Index int
+	Email string
+	Err   error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("user %d: %v", e.Index, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportUsers bulk-loads users migrated from another system, keeping their
+// bcrypt or argon2id password hashes. All users are inserted in a single
+// transaction.
+//
+// Users that can't be imported are reported as ImportErrors, wrapping
+// ErrUserExists for duplicate emails and ErrInvalidPasswordHash for hashes
+// in neither format; the rest of the batch is imported regardless. If the
+// batch as a whole fails, the only error is the cause and nothing is
+// imported.
+func (a *Auth) ImportUsers(ctx context.Context, users []models.UserImport) (imported int, errs []error) {
+	const op = "auth.ImportUsers"
+
+	log := a.log.With(slog.String("op", op), slog.Int("count", len(users)))
+
+	log.Info("importing users")
+
+	valid := make([]models.UserImport, 0, len(users))
+	indexes := make([]int, 0, len(users))
+
+	for i, user := range users {
+		if passhash.Algorithm(user.PassHash) == "" {
+			errs = append(errs, &ImportError{Index: i, Email: user.Email, Err: ErrInvalidPasswordHash})
+
+			continue
+		}
+
+		user.Email = normalizeEmail(user.Email)
+		valid = append(valid, user)
+		indexes = append(indexes, i)
+	}
+
+	results, err := a.userSaver.ImportUsers(ctx, valid)
+	if err != nil {
+		log.Error("failed to import users", slog.String("error", err.Error()))
+
+		return 0, []error{opError(op, err)}
+	}
+
+	for i, err := range results {
+		if err != nil {
+			errs = append(errs, &ImportError{Index: indexes[i], Email: valid[i].Email, Err: err})
+
+			continue
+		}
+
+		imported++
+	}
+
+	slices.SortFunc(errs, func(a, b error) int {
+		return a.(*ImportError).Index - b.(*ImportError).Index
+	})
+
+	log.Info("users imported", slog.Int("imported", imported), slog.Int("failed", len(errs)))
+
+	return imported, errs
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sso/internal/domain/models"
+	"time"
+)
+
+// Recorder receives the result and latency of instrumented Auth operations.
+// result is "success" or, on failure, the reason returned by failureReason.
+type Recorder interface {
+	Observe(op, result string, duration time.Duration)
+}
+
+// InstrumentedAuth is an Auth reporting Login, LoginV2, LoginWithOptions,
+// RegisterNewUser, IsAdmin and ValidateToken calls to a Recorder. Other
+// methods are passed through as is.
+type InstrumentedAuth struct {
+	*Auth
+	rec Recorder
+}
+
+// NewInstrumented wraps a so that its calls are reported to rec.
+func NewInstrumented(a *Auth, rec Recorder) *InstrumentedAuth {
+	return &InstrumentedAuth{Auth: a, rec: rec}
+}
+
+func (i *InstrumentedAuth) Login(ctx context.Context, identifier, password string, appID int) (string, error) {
+	start := time.Now()
+
+	token, err := i.Auth.Login(ctx, identifier, password, appID)
+	i.observe("login", start, err)
+
+	return token, err
+}
+
+func (i *InstrumentedAuth) LoginV2(ctx context.Context, identifier, password string, appID int) (models.LoginResult, error) {
+	start := time.Now()
+
+	res, err := i.Auth.LoginV2(ctx, identifier, password, appID)
+	i.observe("login", start, err)
+
+	return res, err
+}
+
+func (i *InstrumentedAuth) LoginWithOptions(ctx context.Context, identifier, password string, appID int, opts LoginOptions) (models.LoginResult, error) {
+	start := time.Now()
+
+	res, err := i.Auth.LoginWithOptions(ctx, identifier, password, appID, opts)
+	i.observe("login", start, err)
+
+	return res, err
+}
+
+func (i *InstrumentedAuth) RegisterNewUser(ctx context.Context, email, password string) (int64, error) {
+	start := time.Now()
+
+	userID, err := i.Auth.RegisterNewUser(ctx, email, password)
+	i.observe("register", start, err)
+
+	return userID, err
+}
+
+func (i *InstrumentedAuth) RegisterNewUserWithUsername(ctx context.Context, email, username, password string) (int64, error) {
+	start := time.Now()
+
+	userID, err := i.Auth.RegisterNewUserWithUsername(ctx, email, username, password)
+	i.observe("register", start, err)
+
+	return userID, err
+}
+
+func (i *InstrumentedAuth) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	start := time.Now()
+
+	isAdmin, err := i.Auth.IsAdmin(ctx, userID)
+	i.observe("is_admin", start, err)
+
+	return isAdmin, err
+}
+
+func (i *InstrumentedAuth) ValidateToken(ctx context.Context, token string) (models.TokenClaims, error) {
+	start := time.Now()
+
+	claims, err := i.Auth.ValidateToken(ctx, token)
+	i.observe("validate_token", start, err)
+
+	return claims, err
+}
+
+func (i *InstrumentedAuth) observe(op string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = failureReason(err)
+	}
+
+	i.rec.Observe(op, result, time.Since(start))
+}
+
+// failureReason maps an error returned by Auth to a short label suitable for
+// metrics, such as "user_not_found" or "invalid_password". Unlike the
+// returned error, it tells apart why credentials were rejected, so it must
+// never reach callers.
+func failureReason(err error) string {
+	var credErr credentialsError
+	if errors.As(err, &credErr) && credErr.reason != "" {
+		return credErr.reason
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return "invalid_input"
+	}
+
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, ErrUserExists):
+		return "user_exists"
+	case errors.Is(err, ErrUserNotFound):
+		return "user_not_found"
+	case errors.Is(err, ErrWeakPassword):
+		return "weak_password"
+	case errors.Is(err, ErrPasswordTooLong):
+		return "password_too_long"
+	case errors.Is(err, ErrAccountLocked):
+		return "account_locked"
+	case errors.Is(err, ErrAccountDisabled):
+		return "account_disabled"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrPermissionDenied):
+		return "permission_denied"
+	case errors.Is(err, ErrInvalidAppID):
+		return "invalid_app_id"
+	case errors.Is(err, ErrInvalidUserID):
+		return "invalid_user_id"
+	case errors.Is(err, ErrTOTPRequired):
+		return "totp_required"
+	case errors.Is(err, ErrInvalidTOTPCode):
+		return "invalid_totp_code"
+	case errors.Is(err, ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, ErrTokenExpired):
+		return "token_expired"
+	case errors.Is(err, ErrTokenRevoked):
+		return "token_revoked"
+	case errors.Is(err, ErrInvalidToken):
+		return "invalid_token"
+	case errors.Is(err, ErrInvalidMagicLink):
+		return "invalid_magic_link"
+	case errors.Is(err, ErrFingerprintRequired):
+		return "fingerprint_required"
+	case errors.Is(err, ErrFingerprintMismatch):
+		return "fingerprint_mismatch"
+	case isContextError(err):
+		return "canceled"
+	default:
+		return "internal"
+	}
+}
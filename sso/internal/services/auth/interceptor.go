@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sso/internal/domain/models"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const bearerPrefix = "bearer "
+
+type claimsKey struct{}
+
+// AuthInterceptor returns a unary server interceptor that authenticates calls
+// with the bearer token from the "authorization" metadata and stores its
+// claims in the request context. Calls to publicMethods, given as full method
+// names such as "/auth.Auth/Login", are passed through without a token.
+//
+// Calls without a valid token fail with codes.Unauthenticated.
+func AuthInterceptor(a *Auth, publicMethods ...string) grpc.UnaryServerInterceptor {
+	public := make(map[string]struct{}, len(publicMethods))
+	for _, method := range publicMethods {
+		public[method] = struct{}{}
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := public[info.FullMethod]; ok {
+			return handler(ctx, req)
+		}
+
+		token, ok := BearerToken(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+		}
+
+		claims, err := a.ValidateToken(ctx, token)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidToken) &&
+				!errors.Is(err, ErrTokenExpired) &&
+				!errors.Is(err, ErrTokenRevoked) &&
+				!errors.Is(err, ErrFingerprintMismatch) {
+				return nil, status.Error(codes.Internal, "internal error")
+			}
+
+			a.log.Warn("unauthenticated call",
+				slog.String("method", info.FullMethod),
+				slog.String("error", err.Error()),
+			)
+
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		return handler(context.WithValue(ctx, claimsKey{}, claims), req)
+	}
+}
+
+// ClaimsFromContext returns the claims stored by AuthInterceptor.
+func ClaimsFromContext(ctx context.Context) (models.TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(models.TokenClaims)
+
+	return claims, ok
+}
+
+// BearerToken returns the bearer token of the "authorization" metadata of an
+// incoming call.
+func BearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+
+	if len(values[0]) <= len(bearerPrefix) || !strings.EqualFold(values[0][:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(values[0][len(bearerPrefix):]), true
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sso/internal/domain/models"
+)
+
+// Introspect reports whether a token is active, after RFC 7662, and if so
+// what it was issued for. Unlike ValidateToken, which fails for unusable
+// tokens, it only fails if the token's state can't be determined: invalid,
+// expired and revoked tokens are reported as inactive. Revocations are
+// always checked against storage, so the answer is authoritative. Tokens
+// bound to a client are introspected without their client's fingerprint,
+// which only the client presenting them has.
+func (a *Auth) Introspect(ctx context.Context, token string) (models.IntrospectionResult, error) {
+	const op = "auth.Introspect"
+
+	claims, err := a.validateToken(ctx, token, false)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrTokenRevoked) {
+			return models.IntrospectionResult{}, nil
+		}
+
+		return models.IntrospectionResult{}, opError(op, err)
+	}
+
+	return models.IntrospectionResult{
+		Active:    true,
+		UserID:    claims.UserID,
+		AppID:     claims.AppID,
+		ExpiresAt: claims.ExpiresAt,
+		Roles:     claims.Roles,
+		Scopes:    claims.Scopes,
+		AMR:       claims.AMR,
+		GrantType: claims.GrantType,
+	}, nil
+}
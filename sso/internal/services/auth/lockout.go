@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/ratelimit"
+	"time"
+)
+
+// padLogin sleeps until minLoginDuration has passed since start. It returns
+// early once ctx is done, and doesn't sleep at all if it already is.
+func (a *Auth) padLogin(ctx context.Context, start time.Time) {
+	if a.minLoginDuration <= 0 || ctx.Err() != nil {
+		return
+	}
+
+	remaining := a.minLoginDuration - time.Since(start)
+	if remaining <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// checkLockout returns ErrAccountLocked if the account is currently locked
+// out after too many failed logins.
+func (a *Auth) checkLockout(ctx context.Context, email string) error {
+	if a.maxLoginAttempts <= 0 {
+		return nil
+	}
+
+	attempts, err := a.attempts.LoginAttempts(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to get login attempts: %w", err)
+	}
+
+	if a.clock.Now().Before(attempts.LockedUntil) {
+		a.log.Warn("account is locked", a.emailAttr("email", email), slog.Time("locked_until", attempts.LockedUntil))
+
+		return ErrAccountLocked
+	}
+
+	return nil
+}
+
+// recordFailedLogin increments the consecutive failure counter and locks the
+// account once it reaches maxLoginAttempts. Unknown emails are counted too,
+// so the lockout can't be used to tell registered emails apart.
+func (a *Auth) recordFailedLogin(ctx context.Context, email string) error {
+	if a.maxLoginAttempts <= 0 {
+		return nil
+	}
+
+	failed, err := a.attempts.IncrementFailedLogins(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to record failed login: %w", err)
+	}
+
+	if failed < a.maxLoginAttempts {
+		return nil
+	}
+
+	lockedUntil := a.clock.Now().Add(a.lockoutDuration)
+
+	if err := a.attempts.LockAccount(ctx, email, lockedUntil); err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+
+	a.log.Warn("account locked", a.emailAttr("email", email), slog.Time("locked_until", lockedUntil))
+
+	return nil
+}
+
+// resetFailedLogins clears the failure counter after a successful login.
+func (a *Auth) resetFailedLogins(ctx context.Context, email string) error {
+	if a.maxLoginAttempts <= 0 {
+		return nil
+	}
+
+	if err := a.attempts.ResetLoginAttempts(ctx, email); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+
+	return nil
+}
+
+// checkRateLimit returns ErrRateLimited if the caller identified by the
+// context's rate limiting key has made too many login attempts. Calls
+// without a key aren't limited.
+func (a *Auth) checkRateLimit(ctx context.Context) error {
+	key := ratelimit.KeyFromContext(ctx)
+	if a.limiter == nil || key == "" {
+		return nil
+	}
+
+	allowed, err := a.limiter.Allow(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to check rate limit: %w", err)
+	}
+
+	if !allowed {
+		a.log.Warn("login rate limited", slog.String("key", key))
+
+		return ErrRateLimited
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/lib/requestmeta"
+)
+
+// traceIDer is implemented by Tracers that can tell the ID of the trace a
+// context is part of, so that it can be logged.
+type traceIDer interface {
+	TraceID(ctx context.Context) string
+}
+
+// opLogger returns the logger of op with attrs, plus the request ID, caller IP
+// and trace ID found in ctx, so that the logs of a request can be correlated
+// without passing them around.
+func (a *Auth) opLogger(ctx context.Context, op string, attrs ...slog.Attr) *slog.Logger {
+	args := make([]any, 0, len(attrs)+4)
+	args = append(args, slog.String("op", op))
+
+	for _, attr := range a.contextAttrs(ctx) {
+		args = append(args, attr)
+	}
+
+	for _, attr := range attrs {
+		args = append(args, attr)
+	}
+
+	return a.log.With(args...)
+}
+
+// contextAttrs returns the log attributes of the request ctx belongs to.
+// Unknown values are left out.
+func (a *Auth) contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+
+	meta := requestmeta.FromContext(ctx)
+	if meta.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", meta.RequestID))
+	}
+
+	if meta.IP != "" {
+		attrs = append(attrs, slog.String("ip", meta.IP))
+	}
+
+	if t, ok := a.tracer.(traceIDer); ok {
+		if traceID := t.TraceID(ctx); traceID != "" {
+			attrs = append(attrs, slog.String("trace_id", traceID))
+		}
+	}
+
+	return attrs
+}
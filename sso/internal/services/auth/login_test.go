@@ -0,0 +1,190 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"sso/internal/domain/models"
+	"sso/internal/lib/passhash"
+	"sso/internal/services/auth"
+	"sso/internal/storage/sqlite"
+	"sync"
+	"testing"
+	"time"
+)
+
+// spanRecorder is an auth.Tracer keeping the errors recorded on spans with
+// the given name.
+type spanRecorder struct {
+	name string
+
+	mu     sync.Mutex
+	spans  int
+	errors []error
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string) (context.Context, auth.Span) {
+	if name != r.name {
+		return ctx, recordedSpan{}
+	}
+
+	r.mu.Lock()
+	r.spans++
+	r.mu.Unlock()
+
+	return ctx, recordedSpan{r: r}
+}
+
+type recordedSpan struct {
+	r *spanRecorder
+}
+
+func (s recordedSpan) RecordError(err error) {
+	if s.r == nil {
+		return
+	}
+
+	s.r.mu.Lock()
+	s.r.errors = append(s.r.errors, err)
+	s.r.mu.Unlock()
+}
+
+func (recordedSpan) End() {}
+
+func TestLoginComparesPasswordForUnknownUsers(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantErr  error
+		// wantCmpErr is the error of the password comparison, nil if it
+		// succeeds.
+		wantCmpErr error
+	}{
+		{name: "correct password", email: testEmail, password: testPassword},
+		{name: "wrong password", email: testEmail, password: "wrong-password-1", wantErr: auth.ErrInvalidCredentials, wantCmpErr: passhash.ErrMismatch},
+		{name: "unknown user", email: "unknown@example.com", password: testPassword, wantErr: auth.ErrInvalidCredentials, wantCmpErr: passhash.ErrMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			tracer := &spanRecorder{name: "password.Compare"}
+			a := newTestAuth(t, s, func(cfg *auth.Config) {
+				cfg.Tracer = tracer
+			})
+
+			registerUser(t, a, testEmail)
+
+			if _, err := a.Login(ctx, tt.email, tt.password, testAppID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Login() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tracer.spans != 1 {
+				t.Fatalf("compared passwords %d times, want 1", tracer.spans)
+			}
+
+			if tt.wantCmpErr == nil {
+				if len(tracer.errors) != 0 {
+					t.Fatalf("comparison errors = %v, want none", tracer.errors)
+				}
+
+				return
+			}
+
+			if len(tracer.errors) != 1 || !errors.Is(tracer.errors[0], tt.wantCmpErr) {
+				t.Fatalf("comparison errors = %v, want %v", tracer.errors, tt.wantCmpErr)
+			}
+		})
+	}
+}
+
+// failingSessions is a session storage failing to save sessions for the
+// given app.
+type failingSessions struct {
+	*sqlite.Storage
+	appID int
+}
+
+func (s failingSessions) SaveSession(ctx context.Context, session models.Session) error {
+	if session.AppID == s.appID {
+		return errors.New("session storage is down")
+	}
+
+	return s.Storage.SaveSession(ctx, session)
+}
+
+func TestLoginFailingToStartSession(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	hooked := make(chan int, 10)
+	notifier := loginNotifier(make(chan int, 10))
+	a := newTestAuth(t, s, func(cfg *auth.Config) {
+		cfg.AuditLog = s
+		cfg.Sessions = failingSessions{Storage: s, appID: testAppID}
+		cfg.Hooks.OnLogin = func(_ context.Context, _ int64, appID int) { hooked <- appID }
+		cfg.LoginNotifier = notifier
+	})
+
+	otherAppID, err := s.SaveApp(ctx, "other", "other-secret")
+	if err != nil {
+		t.Fatalf("failed to save app: %v", err)
+	}
+
+	userID := registerUser(t, a, testEmail)
+
+	if _, err := a.Login(ctx, testEmail, testPassword, testAppID); err == nil {
+		t.Fatal("Login() succeeded without a session")
+	}
+
+	events, err := s.AuthEvents(ctx, userID, 100)
+	if err != nil {
+		t.Fatalf("failed to get audit events: %v", err)
+	}
+
+	for _, event := range events {
+		if event.Type == models.AuthEventLogin {
+			t.Fatalf("audit log records the failed login as %+v", event)
+		}
+	}
+
+	// Hooks run asynchronously, so a login to another app that goes through
+	// tells when the failed one's would have run.
+	if _, err := a.Login(ctx, testEmail, testPassword, otherAppID); err != nil {
+		t.Fatalf("failed to login to another app: %v", err)
+	}
+
+	assertOnlyLoginTo(t, "OnLogin hook", hooked, otherAppID)
+	assertOnlyLoginTo(t, "login notifier", notifier, otherAppID)
+}
+
+// loginNotifier is an auth.LoginNotifier reporting the apps logged in to.
+type loginNotifier chan int
+
+func (n loginNotifier) NotifyLogin(_ context.Context, notification models.LoginNotification) error {
+	n <- notification.AppID
+
+	return nil
+}
+
+// assertOnlyLoginTo fails the test if the first login reported on logins
+// isn't to appID, or another is reported shortly after it.
+func assertOnlyLoginTo(t *testing.T, name string, logins <-chan int, appID int) {
+	t.Helper()
+
+	select {
+	case got := <-logins:
+		if got != appID {
+			t.Fatalf("%s ran for a login to app %d, want %d", name, got, appID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s didn't run for the successful login", name)
+	}
+
+	select {
+	case got := <-logins:
+		t.Fatalf("%s ran again, for a login to app %d", name, got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
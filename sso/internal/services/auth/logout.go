@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/domain/models"
+	"time"
+)
+
+// Logout revokes the given token so that subsequent ValidateToken calls
+// for it fail with ErrTokenRevoked.
+//
+// The method returns the same errors as ValidateToken if the token is not
+// currently valid.
+func (a *Auth) Logout(ctx context.Context, token string) error {
+	const op = "auth.Logout"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("logging out user")
+
+	claims, err := a.ValidateToken(ctx, token)
+	if err != nil {
+		return opError(op, err)
+	}
+
+	if claims.ID == "" {
+		log.Warn("token has no jti", slog.Int64("user_id", claims.UserID))
+
+		return opError(op, ErrInvalidToken)
+	}
+
+	if err := a.tokenRevoker.RevokeToken(ctx, claims.ID, claims.ExpiresAt); err != nil {
+		log.Error("failed to revoke token", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("user logged out", slog.Int64("user_id", claims.UserID))
+
+	a.recordEvent(ctx, models.AuthEventLogout, claims.UserID, "")
+
+	return nil
+}
+
+// RunRevokedTokensCleanup periodically purges revocation entries whose tokens
+// have already expired, since those tokens are rejected on expiry anyway.
+// It blocks until ctx is cancelled.
+func (a *Auth) RunRevokedTokensCleanup(ctx context.Context, interval time.Duration) {
+	const op = "auth.RunRevokedTokensCleanup"
+
+	log := a.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := a.tokenRevoker.DeleteExpiredRevokedTokens(ctx, a.clock.Now())
+			if err != nil {
+				log.Error("failed to purge revoked tokens", slog.String("error", err.Error()))
+
+				continue
+			}
+
+			log.Debug("purged revoked tokens", slog.Int64("count", n))
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/storage"
+	"time"
+)
+
+// defaultMagicLinkTTL is how long magic links stay valid, unless configured
+// otherwise.
+const defaultMagicLinkTTL = 10 * time.Minute
+
+// RequestMagicLink issues a single-use token that logs the user in when
+// redeemed with LoginWithMagicLink within the configured magic link TTL. The
+// token is meant to be sent to the user's email as a link.
+//
+// To avoid leaking which emails are registered, the method returns an empty
+// token and no error when the user doesn't exist, and callers should respond
+// the same way whether or not they got a token. It returns
+// ErrMagicLinksDisabled if no magic link storage is configured.
+func (a *Auth) RequestMagicLink(ctx context.Context, email string) (token string, err error) {
+	const op = "auth.RequestMagicLink"
+
+	if a.magicLinks == nil {
+		return "", opError(op, ErrMagicLinksDisabled)
+	}
+
+	email = normalizeEmail(email)
+
+	log := a.log.With(slog.String("op", op), a.emailAttr("email", email))
+
+	log.Info("requesting magic link")
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return "", nil
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	token, err = newOpaqueToken()
+	if err != nil {
+		log.Error("failed to generate magic link token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if err := a.magicLinks.SaveMagicLink(ctx, user.ID, hashOpaqueToken(token), a.clock.Now().Add(a.magicLinkTTL)); err != nil {
+		log.Error("failed to save magic link token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	log.Info("magic link requested", slog.Int64("user_id", user.ID))
+
+	return token, nil
+}
+
+// LoginWithMagicLink redeems a token issued by RequestMagicLink and returns an
+// access token for the given app, like Login. The magic link can't be used
+// again afterwards, even if the login fails.
+//
+// The method returns ErrInvalidMagicLink if the token is unknown, already used
+// or expired, ErrAccountDisabled if the user is disabled, and ErrTOTPRequired
+// if the user has two-factor authentication enabled, as a magic link doesn't
+// stand in for the second factor. Email verification isn't required, since
+// following the link proves the user owns the email.
+func (a *Auth) LoginWithMagicLink(ctx context.Context, token string, appID int) (accessToken string, err error) {
+	const op = "auth.LoginWithMagicLink"
+
+	defer a.padLogin(ctx, time.Now())
+
+	ctx, end := a.startSpan(ctx, op)
+	defer end(&err)
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	log.Info("attempting to login user with magic link")
+
+	user, app, err := a.authenticateMagicLink(ctx, token, appID)
+	if err != nil {
+		a.recordLoginFailure(ctx, err)
+
+		return "", opError(op, err)
+	}
+
+	fingerprint, err := a.loginFingerprint(ctx, user, app)
+	if err != nil {
+		return "", opError(op, err)
+	}
+
+	sessionID, err := a.startSession(ctx, user.ID, app.ID)
+	if err != nil {
+		log.Error("failed to start session", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	accessToken, _, err = a.newToken(ctx, user, app, sessionID, []string{jwt.AMRMagicLink}, fingerprint)
+	if err != nil {
+		log.Error("failed to create token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if err := a.saveOutboxEvent(ctx, models.OutboxEventLogin, user.ID, loginPayload{AppID: app.ID}); err != nil {
+		log.Error("failed to save outbox event", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	log.Info("user logged in successfully", slog.Int64("user_id", user.ID))
+
+	a.recordEvent(ctx, models.AuthEventLogin, user.ID, "")
+	a.onLogin(ctx, user.ID, app.ID)
+
+	return accessToken, nil
+}
+
+// authenticateMagicLink consumes the magic link token and resolves the user
+// it was issued to and the app they are logging in to. The app is looked up
+// first, so that a mistyped app ID doesn't use up the link.
+func (a *Auth) authenticateMagicLink(ctx context.Context, token string, appID int) (models.User, models.App, error) {
+	if a.magicLinks == nil {
+		return models.User{}, models.App{}, ErrMagicLinksDisabled
+	}
+
+	if appID <= 0 {
+		a.log.Warn("invalid app id", slog.Int("app_id", appID))
+
+		return models.User{}, models.App{}, ErrInvalidAppID
+	}
+
+	if err := a.checkRateLimit(ctx); err != nil {
+		return models.User{}, models.App{}, err
+	}
+
+	spanCtx, end := a.startSpan(ctx, "storage.App")
+	app, err := a.appProvider.App(spanCtx, appID)
+	end(&err)
+	if err != nil {
+		reason := reasonLookupFailed
+		if errors.Is(err, storage.ErrAppNotFound) {
+			reason = reasonAppNotFound
+		}
+
+		return models.User{}, models.App{}, a.credentialsFailure(ctx, reason, 0, err)
+	}
+
+	spanCtx, end = a.startSpan(ctx, "storage.ConsumeMagicLink")
+	userID, err := a.magicLinks.ConsumeMagicLink(spanCtx, hashOpaqueToken(token), a.clock.Now())
+	end(&err)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidMagicLink) {
+			a.log.Warn("invalid magic link", slog.String("error", err.Error()))
+
+			return models.User{}, models.App{}, ErrInvalidMagicLink
+		}
+
+		return models.User{}, models.App{}, fmt.Errorf("failed to consume magic link: %w", err)
+	}
+
+	spanCtx, end = a.startSpan(ctx, "storage.UserByID")
+	user, err := a.userProvider.UserByID(spanCtx, userID)
+	end(&err)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			a.log.Warn("magic link of a deleted user", slog.Int64("user_id", userID))
+
+			return models.User{}, models.App{}, ErrInvalidMagicLink
+		}
+
+		return models.User{}, models.App{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !user.IsActive {
+		a.log.Warn("account disabled", slog.Int64("user_id", user.ID))
+
+		return models.User{}, models.App{}, ErrAccountDisabled
+	}
+
+	if _, err := a.verifyTOTP(ctx, user, ""); err != nil {
+		return models.User{}, models.App{}, err
+	}
+
+	return user, app, nil
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+const opaqueTokenSize = 32
+
+// newOpaqueToken generates a random URL-safe token for refresh and
+// password-reset flows.
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, opaqueTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashOpaqueToken returns the hash under which an opaque token is stored.
+// Only the hash is persisted, so a leaked database can't be used to redeem
+// the tokens.
+func hashOpaqueToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+
+	return sum[:]
+}
@@ -0,0 +1,53 @@
+//go:build otel
+
+// OpenTelemetry tracing pulls in the OpenTelemetry API, so it is only
+// compiled into the service when building with -tags otel.
+package auth
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// NewOTelTracer returns a Tracer creating OpenTelemetry spans with t. Spans
+// carry the operation name in the "op" attribute.
+func NewOTelTracer(t trace.Tracer) Tracer {
+	return otelTracer{tracer: t}
+}
+
+func (t otelTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attribute.String("op", name)))
+
+	return ctx, otelSpan{span: span}
+}
+
+// TraceID returns the ID of the trace of the span in ctx, or "" if there is
+// none.
+func (otelTracer) TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+
+	return sc.TraceID().String()
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
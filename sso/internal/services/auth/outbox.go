@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"time"
+)
+
+const (
+	// defaultOutboxPollInterval is how often RunOutboxPublisher looks for
+	// pending events, unless configured otherwise.
+	defaultOutboxPollInterval = time.Second
+
+	// outboxBatchSize is the number of pending events fetched at once.
+	outboxBatchSize = 100
+
+	// outboxRetention is how long sent events are kept before being purged.
+	outboxRetention = 24 * time.Hour
+)
+
+// OutboxPublisher delivers outbox events to other systems, e.g. a message
+// broker.
+type OutboxPublisher interface {
+	// Publish delivers the event. It may be called more than once for the
+	// same event, so consumers should deduplicate by its ID.
+	Publish(ctx context.Context, event models.OutboxEvent) error
+}
+
+// RunOutboxPublisher periodically hands the events written to the outbox to
+// publisher, oldest first, and marks them as sent. An event failing to
+// publish is retried on the next poll, holding back the ones after it, so
+// that events stay in order. Since an event is only marked once publisher has
+// returned, delivery is at least once. Running it on several instances at the
+// same time publishes events more than once. Sent events are purged after a
+// day. It blocks until ctx is cancelled, and returns right away if no outbox
+// storage is configured.
+func (a *Auth) RunOutboxPublisher(ctx context.Context, publisher OutboxPublisher) {
+	const op = "auth.RunOutboxPublisher"
+
+	log := a.log.With(slog.String("op", op))
+
+	if a.outbox == nil {
+		log.Warn("no outbox storage configured")
+
+		return
+	}
+
+	ticker := time.NewTicker(a.outboxPollInterval)
+	defer ticker.Stop()
+
+	purge := time.NewTicker(time.Hour)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.publishOutbox(ctx, publisher); err != nil {
+				log.Error("failed to publish outbox events", slog.String("error", err.Error()))
+			}
+		case <-purge.C:
+			n, err := a.outbox.DeleteSentOutboxEvents(ctx, a.clock.Now().Add(-outboxRetention))
+			if err != nil {
+				log.Error("failed to purge sent outbox events", slog.String("error", err.Error()))
+
+				continue
+			}
+
+			log.Debug("purged sent outbox events", slog.Int64("count", n))
+		}
+	}
+}
+
+// publishOutbox publishes pending events until none are left or one fails.
+func (a *Auth) publishOutbox(ctx context.Context, publisher OutboxPublisher) error {
+	for {
+		events, err := a.outbox.PendingOutboxEvents(ctx, outboxBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to get pending events: %w", err)
+		}
+
+		for _, event := range events {
+			if err := publisher.Publish(ctx, event); err != nil {
+				return fmt.Errorf("failed to publish event %d: %w", event.ID, err)
+			}
+
+			if err := a.outbox.MarkOutboxEventSent(ctx, event.ID, a.clock.Now()); err != nil {
+				return fmt.Errorf("failed to mark event %d as sent: %w", event.ID, err)
+			}
+		}
+
+		if len(events) < outboxBatchSize {
+			return nil
+		}
+	}
+}
+
+type registeredPayload struct {
+	Email    string `json:"email"`
+	Username string `json:"username,omitempty"`
+}
+
+type loginPayload struct {
+	AppID int `json:"app_id"`
+}
+
+// registrationEvents returns the outbox events to save along with a new
+// user, none if there is no outbox.
+func (a *Auth) registrationEvents(email, username string) ([]models.OutboxEvent, error) {
+	if a.outbox == nil {
+		return nil, nil
+	}
+
+	event, err := a.newOutboxEvent(models.OutboxEventUserRegistered, 0, registeredPayload{Email: email, Username: username})
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.OutboxEvent{event}, nil
+}
+
+// saveOutboxEvent writes an event reporting a change that wasn't made in a
+// transaction of its own, such as a login. It is a no-op without an outbox.
+func (a *Auth) saveOutboxEvent(ctx context.Context, eventType string, userID int64, payload any) error {
+	if a.outbox == nil {
+		return nil
+	}
+
+	event, err := a.newOutboxEvent(eventType, userID, payload)
+	if err != nil {
+		return err
+	}
+
+	// The change has been made, so the event is written even if the request
+	// was cancelled in the meantime.
+	if err := a.outbox.SaveOutboxEvent(context.WithoutCancel(ctx), event); err != nil {
+		return fmt.Errorf("failed to save outbox event: %w", err)
+	}
+
+	return nil
+}
+
+func (a *Auth) newOutboxEvent(eventType string, userID int64, payload any) (models.OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return models.OutboxEvent{}, fmt.Errorf("failed to encode outbox event: %w", err)
+	}
+
+	return models.OutboxEvent{
+		Type:      eventType,
+		UserID:    userID,
+		Payload:   data,
+		CreatedAt: a.clock.Now(),
+	}, nil
+}
@@ -0,0 +1,368 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+	"time"
+)
+
+// ChangePassword replaces the user's password after verifying the current one.
+//
+// The method returns ErrInvalidCredentials if oldPassword doesn't match the
+// stored hash, ErrSamePassword if newPassword equals the current password,
+// ErrPasswordTooLong if either password exceeds the size limit,
+// ErrWeakPassword if newPassword doesn't satisfy the password policy, or
+// ErrUserNotFound if the user doesn't exist.
+func (a *Auth) ChangePassword(ctx context.Context, userID int64, oldPassword, newPassword string) error {
+	const op = "auth.ChangePassword"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	log.Info("changing password")
+
+	for _, password := range []string{oldPassword, newPassword} {
+		if err := a.checkPasswordSize(password); err != nil {
+			log.Warn("password too long", slog.String("error", err.Error()))
+
+			return opError(op, err)
+		}
+	}
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if err := comparePassword(ctx, user.PassHash, oldPassword); err != nil {
+		if isContextError(err) {
+			return opError(op, err)
+		}
+
+		log.Warn("invalid credentials", slog.String("error", err.Error()))
+
+		return opError(op, ErrInvalidCredentials)
+	}
+
+	if oldPassword == newPassword {
+		log.Warn("new password equals the old one")
+
+		return opError(op, ErrSamePassword)
+	}
+
+	if err := a.passwordPolicy.Validate(newPassword); err != nil {
+		log.Warn("weak password", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if err := a.setPassword(ctx, userID, newPassword, false); err != nil {
+		log.Error("failed to set password", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("password changed")
+
+	a.recordEvent(ctx, models.AuthEventPasswordChange, userID, "")
+	a.onPasswordChange(ctx, userID)
+
+	return nil
+}
+
+// VerifyPassword reports whether password is the user's current password,
+// without issuing a token, e.g. to confirm the user's identity before a
+// sensitive action. Like Login, it takes at least the minimum login duration,
+// compares against a dummy hash when the user doesn't exist and counts
+// towards the caller's login rate limit. Mismatches count towards the
+// account's lockout.
+//
+// The method returns ErrInvalidUserID if userID isn't positive,
+// ErrPasswordTooLong if the password exceeds the size limit, ErrRateLimited
+// if the caller exceeded the rate limit, ErrAccountLocked if the account is
+// locked out, or ErrUserNotFound if the user doesn't exist.
+func (a *Auth) VerifyPassword(ctx context.Context, userID int64, password string) (ok bool, err error) {
+	const op = "auth.VerifyPassword"
+
+	defer a.padLogin(ctx, time.Now())
+
+	ctx, end := a.startSpan(ctx, op)
+	defer end(&err)
+
+	log := a.opLogger(ctx, op, slog.Int64("user_id", userID))
+
+	log.Info("verifying password")
+
+	if userID <= 0 {
+		log.Warn("invalid user id")
+
+		return false, opError(op, ErrInvalidUserID)
+	}
+
+	if err := a.checkPasswordSize(password); err != nil {
+		log.Warn("password too long", slog.String("error", err.Error()))
+
+		return false, opError(op, err)
+	}
+
+	if err := a.checkRateLimit(ctx); err != nil {
+		return false, opError(op, err)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			_ = comparePassword(ctx, a.dummyHash, password)
+
+			return false, opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return false, opError(op, err)
+	}
+
+	if err := a.checkLockout(ctx, user.Email); err != nil {
+		return false, opError(op, err)
+	}
+
+	if err := comparePassword(ctx, user.PassHash, password); err != nil {
+		if isContextError(err) {
+			return false, opError(op, err)
+		}
+
+		log.Warn("password mismatch", slog.String("error", err.Error()))
+
+		if err := a.recordFailedLogin(ctx, user.Email); err != nil {
+			log.Error("failed to record failed attempt", slog.String("error", err.Error()))
+
+			return false, opError(op, err)
+		}
+
+		return false, nil
+	}
+
+	if err := a.resetFailedLogins(ctx, user.Email); err != nil {
+		log.Error("failed to reset failed attempts", slog.String("error", err.Error()))
+
+		return false, opError(op, err)
+	}
+
+	a.upgradePasswordHash(ctx, user, password)
+
+	log.Info("password verified")
+
+	return true, nil
+}
+
+// AdminSetPassword sets the password of the target user on behalf of actorID,
+// such as a support agent helping a locked out user, and lifts their lockout.
+// The new password must satisfy the password policy. With
+// TemporaryAdminPasswords configured, the user only gets limited tokens
+// until they change it, see models.LoginResult.PasswordChangeRequired. The
+// change is audited with the actor.
+//
+// The method returns ErrInvalidUserID if either ID isn't positive,
+// ErrPermissionDenied if the actor isn't an admin, ErrPasswordTooLong or
+// ErrWeakPassword if newPassword exceeds the size limit or doesn't satisfy
+// the password policy, or ErrUserNotFound if the target user doesn't exist.
+func (a *Auth) AdminSetPassword(ctx context.Context, actorID, targetID int64, newPassword string) error {
+	const op = "auth.AdminSetPassword"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("actor_id", actorID), slog.Int64("user_id", targetID))
+
+	log.Info("setting password")
+
+	if actorID <= 0 || targetID <= 0 {
+		log.Warn("invalid user id")
+
+		return opError(op, ErrInvalidUserID)
+	}
+
+	isAdmin, err := a.IsAdmin(ctx, actorID)
+	if err != nil {
+		log.Error("failed to check actor", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if !isAdmin {
+		log.Warn("actor is not an admin")
+
+		return opError(op, ErrPermissionDenied)
+	}
+
+	if err := a.checkPasswordSize(newPassword); err != nil {
+		log.Warn("password too long", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if err := a.passwordPolicy.Validate(newPassword); err != nil {
+		log.Warn("weak password", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, targetID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if err := a.setPassword(ctx, targetID, newPassword, a.temporaryAdminPasswords); err != nil {
+		log.Error("failed to set password", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if err := a.resetFailedLogins(ctx, user.Email); err != nil {
+		log.Warn("failed to reset failed attempts", slog.String("error", err.Error()))
+	}
+
+	log.Info("password set")
+
+	a.recordEventBy(ctx, models.AuthEventPasswordSet, actorID, targetID, "")
+	a.onPasswordChange(ctx, targetID)
+
+	return nil
+}
+
+// RequestPasswordReset issues a single-use token that can be redeemed with
+// ResetPassword within the configured reset TTL.
+//
+// To avoid leaking which emails are registered, the method returns an empty
+// token and no error when the user doesn't exist.
+func (a *Auth) RequestPasswordReset(ctx context.Context, email string) (resetToken string, err error) {
+	const op = "auth.RequestPasswordReset"
+
+	email = normalizeEmail(email)
+
+	log := a.log.With(slog.String("op", op), a.emailAttr("email", email))
+
+	log.Info("requesting password reset")
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return "", nil
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	resetToken, err = newOpaqueToken()
+	if err != nil {
+		log.Error("failed to generate reset token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if err := a.resetStore.SavePasswordReset(ctx, user.ID, hashOpaqueToken(resetToken), a.clock.Now().Add(a.resetTTL)); err != nil {
+		log.Error("failed to save reset token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	log.Info("password reset requested", slog.Int64("user_id", user.ID))
+
+	return resetToken, nil
+}
+
+// ResetPassword redeems a token issued by RequestPasswordReset and sets the
+// user's password to newPassword. The token can't be used again afterwards.
+//
+// The method returns ErrPasswordTooLong or ErrWeakPassword if newPassword
+// exceeds the size limit or doesn't satisfy the password policy, in which case
+// the token stays valid, or ErrInvalidResetToken if the token is unknown,
+// already used or expired.
+func (a *Auth) ResetPassword(ctx context.Context, resetToken, newPassword string) error {
+	const op = "auth.ResetPassword"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("resetting password")
+
+	if err := a.checkPasswordSize(newPassword); err != nil {
+		log.Warn("password too long", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if err := a.passwordPolicy.Validate(newPassword); err != nil {
+		log.Warn("weak password", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	userID, err := a.resetStore.ConsumePasswordReset(ctx, hashOpaqueToken(resetToken), a.clock.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidResetToken) {
+			log.Warn("invalid reset token", slog.String("error", err.Error()))
+
+			return opError(op, ErrInvalidResetToken)
+		}
+
+		log.Error("failed to consume reset token", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if err := a.setPassword(ctx, userID, newPassword, false); err != nil {
+		log.Error("failed to set password", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("password reset", slog.Int64("user_id", userID))
+
+	a.onPasswordChange(ctx, userID)
+
+	return nil
+}
+
+// setPassword hashes and stores a new password for the user, along with
+// whether they must change it, revoking their refresh tokens if configured to
+// do so.
+func (a *Auth) setPassword(ctx context.Context, userID int64, password string, mustChange bool) error {
+	passHash, err := hashPassword(ctx, a.hasher, password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := a.userSaver.UpdatePassword(ctx, userID, passHash, mustChange); err != nil {
+		return err
+	}
+
+	if a.revokeOnPasswordChange {
+		if err := a.refreshStore.RevokeRefreshTokens(ctx, userID); err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+	}
+
+	return nil
+}
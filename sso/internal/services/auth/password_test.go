@@ -0,0 +1,55 @@
+package auth_test
+
+import (
+	"context"
+	"sso/internal/services/auth"
+	"testing"
+)
+
+func TestAdminSetPassword(t *testing.T) {
+	ctx := context.Background()
+	const newPassword = "battery-staple-2"
+
+	tests := []struct {
+		name      string
+		temporary bool
+	}{
+		{name: "permanent"},
+		{name: "temporary", temporary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			a := newTestAuth(t, s, func(cfg *auth.Config) {
+				cfg.BootstrapFirstAdmin = true
+				cfg.TemporaryAdminPasswords = tt.temporary
+			})
+
+			adminID := registerUser(t, a, "admin@example.com")
+			userID := registerUser(t, a, testEmail)
+
+			if err := a.AdminSetPassword(ctx, adminID, userID, newPassword); err != nil {
+				t.Fatalf("AdminSetPassword() error = %v", err)
+			}
+
+			user, err := s.UserByID(ctx, userID)
+			if err != nil {
+				t.Fatalf("failed to get user: %v", err)
+			}
+
+			if user.MustChangePassword != tt.temporary {
+				t.Errorf("MustChangePassword = %v, want %v", user.MustChangePassword, tt.temporary)
+			}
+
+			res, err := a.LoginV2(ctx, testEmail, newPassword, testAppID)
+			if err != nil {
+				t.Fatalf("failed to login with the new password: %v", err)
+			}
+
+			if res.PasswordChangeRequired != tt.temporary {
+				t.Errorf("PasswordChangeRequired = %v, want %v", res.PasswordChangeRequired, tt.temporary)
+			}
+		})
+	}
+}
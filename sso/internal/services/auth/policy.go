@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy describes the passwords accepted by RegisterNewUser,
+// ChangePassword and ResetPassword. The zero value accepts any password up to
+// the default MaxBytes.
+type PasswordPolicy struct {
+	// MinLength and MaxLength bound the password length in characters.
+	// Zero disables the respective check.
+	MinLength int
+	MaxLength int
+
+	// MaxBytes caps the size of every password the service is given, on
+	// login as well, so that oversized ones are rejected with
+	// ErrPasswordTooLong before any hashing. Zero means 72 with bcrypt,
+	// which ignores the bytes past those, and 1024 otherwise. Bcrypt
+	// passwords are never allowed more than 72 bytes.
+	MaxBytes int
+
+	RequireDigit  bool
+	RequireUpper  bool
+	RequireSymbol bool
+
+	// RejectCommon rejects passwords from a built-in list of commonly used
+	// passwords.
+	RejectCommon bool
+}
+
+// commonPasswords holds frequently used passwords, compared case-insensitively.
+var commonPasswords = map[string]struct{}{
+	"123456": {}, "12345678": {}, "123456789": {}, "1234567890": {}, "12345": {},
+	"111111": {}, "000000": {}, "123123": {}, "654321": {}, "666666": {},
+	"password": {}, "password1": {}, "password123": {}, "passw0rd": {}, "qwerty": {},
+	"qwerty123": {}, "qwertyuiop": {}, "abc123": {}, "iloveyou": {}, "admin": {},
+	"admin123": {}, "welcome": {}, "welcome1": {}, "letmein": {}, "monkey": {},
+	"dragon": {}, "football": {}, "baseball": {}, "sunshine": {}, "princess": {},
+	"master": {}, "shadow": {}, "superman": {}, "trustno1": {}, "1q2w3e4r": {},
+	"asdfghjkl": {}, "zaq12wsx": {}, "changeme": {}, "secret": {}, "login": {},
+}
+
+// Validate checks the password against the policy. The returned error wraps
+// ErrWeakPassword and names the first rule the password breaks.
+func (p PasswordPolicy) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+
+	if p.MinLength > 0 && length < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters long", ErrWeakPassword, p.MinLength)
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w: must be at most %d characters long", ErrWeakPassword, p.MaxLength)
+	}
+
+	var hasDigit, hasUpper, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireDigit && !hasDigit {
+		return fmt.Errorf("%w: must contain a digit", ErrWeakPassword)
+	}
+
+	if p.RequireUpper && !hasUpper {
+		return fmt.Errorf("%w: must contain an uppercase letter", ErrWeakPassword)
+	}
+
+	if p.RequireSymbol && !hasSymbol {
+		return fmt.Errorf("%w: must contain a symbol", ErrWeakPassword)
+	}
+
+	if p.RejectCommon {
+		if _, ok := commonPasswords[strings.ToLower(password)]; ok {
+			return fmt.Errorf("%w: is too common", ErrWeakPassword)
+		}
+	}
+
+	return nil
+}
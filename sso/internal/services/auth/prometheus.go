@@ -0,0 +1,52 @@
+//go:build prometheus
+
+// Prometheus metrics pull in the Prometheus client, so they are only compiled
+// into the service when building with -tags prometheus.
+package auth
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type prometheusRecorder struct {
+	operations *prometheus.CounterVec
+	durations  *prometheus.HistogramVec
+}
+
+// NewInstrumentedAuth wraps a with Prometheus metrics registered with reg:
+// sso_auth_operations_total counts calls by operation and result, and
+// sso_auth_operation_duration_seconds tracks their latency.
+func NewInstrumentedAuth(a *Auth, reg prometheus.Registerer) (*InstrumentedAuth, error) {
+	rec := &prometheusRecorder{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "sso",
+			Subsystem: "auth",
+			Name:      "operations_total",
+			Help:      "Number of auth operations by operation and result.",
+		}, []string{"op", "result"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "sso",
+			Subsystem: "auth",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of auth operations by operation and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"op", "result"}),
+	}
+
+	if err := reg.Register(rec.operations); err != nil {
+		return nil, err
+	}
+
+	if err := reg.Register(rec.durations); err != nil {
+		return nil, err
+	}
+
+	return NewInstrumented(a, rec), nil
+}
+
+func (r *prometheusRecorder) Observe(op, result string, duration time.Duration) {
+	r.operations.WithLabelValues(op, result).Inc()
+	r.durations.WithLabelValues(op, result).Observe(duration.Seconds())
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/requestmeta"
+	"sso/internal/storage"
+	"strconv"
+	"time"
+)
+
+// LoginWithRefresh authenticates a user like Login and additionally issues a
+// long-lived refresh token that can be exchanged for new access tokens via
+// Refresh.
+func (a *Auth) LoginWithRefresh(ctx context.Context, email, password string, appID int) (accessToken, refreshToken string, err error) {
+	res, err := a.login(ctx, "auth.LoginWithRefresh", email, password, appID, a.refreshTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return res.AccessToken, res.RefreshToken, nil
+}
+
+// Refresh issues a new access token for the given app in exchange for a
+// refresh token previously returned by LoginWithRefresh for the same app.
+//
+// The method returns ErrRefreshTokenNotFound if the token is unknown,
+// ErrRefreshTokenRevoked if it has been revoked, ErrRefreshTokenExpired
+// if it is past its TTL, ErrTokenAppMismatch if it was issued for
+// another app, or ErrFingerprintMismatch if it is bound to another client.
+func (a *Auth) Refresh(ctx context.Context, refreshToken string, appID int) (accessToken string, err error) {
+	const op = "auth.Refresh"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	log.Info("refreshing access token")
+
+	stored, err := a.refreshStore.RefreshToken(ctx, hashOpaqueToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			log.Warn("refresh token not found", slog.String("error", err.Error()))
+
+			return "", opError(op, ErrRefreshTokenNotFound)
+		}
+
+		log.Error("failed to get refresh token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if stored.Revoked {
+		log.Warn("refresh token revoked", slog.Int64("user_id", stored.UserID))
+
+		return "", opError(op, ErrRefreshTokenRevoked)
+	}
+
+	if !a.clock.Now().Before(stored.ExpiresAt) {
+		log.Warn("refresh token expired", slog.Int64("user_id", stored.UserID))
+
+		return "", opError(op, ErrRefreshTokenExpired)
+	}
+
+	// Tokens issued before they were bound to apps carry no app ID and are
+	// accepted for any app until they expire.
+	if stored.AppID != 0 && stored.AppID != appID {
+		log.Warn("refresh token issued for another app", slog.Int64("user_id", stored.UserID), slog.Int("token_app_id", stored.AppID))
+
+		return "", opError(op, ErrTokenAppMismatch)
+	}
+
+	if err := checkFingerprint(ctx, stored.Fingerprint); err != nil {
+		log.Warn("refresh token presented by another client", slog.Int64("user_id", stored.UserID))
+
+		return "", opError(op, err)
+	}
+
+	if err := a.checkSession(ctx, stored.SessionID); err != nil {
+		if errors.Is(err, ErrTokenRevoked) {
+			log.Warn("session revoked", slog.String("sid", stored.SessionID))
+
+			return "", opError(op, ErrRefreshTokenRevoked)
+		}
+
+		log.Error("failed to check session", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, stored.UserID)
+	if err != nil {
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if !user.IsActive {
+		log.Warn("account disabled", slog.Int64("user_id", user.ID))
+
+		return "", opError(op, ErrAccountDisabled)
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		log.Warn("failed to get app", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	fingerprint, err := a.tokenFingerprint(ctx, app)
+	if err != nil {
+		log.Warn("client fingerprint required", slog.Int64("user_id", user.ID))
+
+		return "", opError(op, err)
+	}
+
+	accessToken, _, err = a.newToken(ctx, user, app, stored.SessionID, stored.AMR, fingerprint)
+	if err != nil {
+		log.Error("failed to create token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if err := a.refreshStore.TouchRefreshToken(ctx, stored.ID, a.clock.Now()); err != nil {
+		log.Warn("failed to touch refresh token", slog.String("error", err.Error()))
+	}
+
+	log.Info("access token refreshed", slog.Int64("user_id", user.ID))
+
+	return accessToken, nil
+}
+
+// ListRefreshTokens returns the user's refresh tokens that can still be
+// redeemed, most recently issued first, so that they can revoke those of a
+// lost device. The tokens themselves are never returned.
+//
+// The method returns ErrInvalidUserID if userID isn't positive.
+func (a *Auth) ListRefreshTokens(ctx context.Context, userID int64) ([]models.RefreshTokenInfo, error) {
+	const op = "auth.ListRefreshTokens"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	if userID <= 0 {
+		log.Warn("invalid user id")
+
+		return nil, opError(op, ErrInvalidUserID)
+	}
+
+	tokens, err := a.refreshStore.ListRefreshTokens(ctx, userID, a.clock.Now())
+	if err != nil {
+		log.Error("failed to list refresh tokens", slog.String("error", err.Error()))
+
+		return nil, opError(op, err)
+	}
+
+	infos := make([]models.RefreshTokenInfo, 0, len(tokens))
+	for _, token := range tokens {
+		infos = append(infos, models.RefreshTokenInfo{
+			ID:         strconv.FormatInt(token.ID, 10),
+			SessionID:  token.SessionID,
+			Device:     token.Device,
+			CreatedAt:  token.CreatedAt,
+			LastUsedAt: token.LastUsedAt,
+			ExpiresAt:  token.ExpiresAt,
+		})
+	}
+
+	return infos, nil
+}
+
+// RevokeRefreshToken revokes the refresh token with the given ID, as listed
+// by ListRefreshTokens, so that it can no longer be redeemed for access
+// tokens. Access tokens already issued stay valid until they expire; revoke
+// the token's session to end those too. Like RevokeSession, the method
+// doesn't check who owns the token, which is up to the caller.
+//
+// The method returns ErrRefreshTokenNotFound if no token has the given ID.
+func (a *Auth) RevokeRefreshToken(ctx context.Context, tokenID string) error {
+	const op = "auth.RevokeRefreshToken"
+
+	log := a.log.With(slog.String("op", op), slog.String("token_id", tokenID))
+
+	log.Info("revoking refresh token")
+
+	id, err := strconv.ParseInt(tokenID, 10, 64)
+	if err != nil || id <= 0 {
+		log.Warn("invalid refresh token id")
+
+		return opError(op, ErrRefreshTokenNotFound)
+	}
+
+	if err := a.refreshStore.RevokeRefreshTokenByID(ctx, id); err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			log.Warn("refresh token not found", slog.String("error", err.Error()))
+
+			return opError(op, ErrRefreshTokenNotFound)
+		}
+
+		log.Error("failed to revoke refresh token", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("refresh token revoked")
+
+	return nil
+}
+
+// issueRefreshToken generates a random refresh token for the user's session in
+// the given app, valid for ttl, and stores its hash along with the
+// authentication methods of the login and the client fingerprint it is bound
+// to, if any.
+func (a *Auth) issueRefreshToken(ctx context.Context, userID int64, appID int, sessionID string, ttl time.Duration, amr []string, fingerprint string) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := a.clock.Now()
+
+	err = a.refreshStore.SaveRefreshToken(ctx, models.RefreshToken{
+		UserID:      userID,
+		AppID:       appID,
+		SessionID:   sessionID,
+		TokenHash:   hashOpaqueToken(token),
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+		Device:      requestmeta.FromContext(ctx).UserAgent,
+		AMR:         amr,
+		Fingerprint: fingerprint,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
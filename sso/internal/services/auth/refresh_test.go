@@ -0,0 +1,51 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"sso/internal/services/auth"
+	"testing"
+)
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	a := newTestAuth(t, s, nil)
+
+	otherAppID, err := s.SaveApp(ctx, "other", "other-secret")
+	if err != nil {
+		t.Fatalf("failed to save app: %v", err)
+	}
+
+	registerUser(t, a, testEmail)
+
+	accessToken, refreshToken, err := a.LoginWithRefresh(ctx, testEmail, testPassword, testAppID)
+	if err != nil {
+		t.Fatalf("failed to login: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		appID   int
+		wantErr error
+	}{
+		{name: "same app", token: refreshToken, appID: testAppID},
+		{name: "other app", token: refreshToken, appID: otherAppID, wantErr: auth.ErrTokenAppMismatch},
+		{name: "unknown token", token: "unknown", appID: testAppID, wantErr: auth.ErrRefreshTokenNotFound},
+		{name: "access token", token: accessToken, appID: testAppID, wantErr: auth.ErrRefreshTokenNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessToken, err := a.Refresh(ctx, tt.token, tt.appID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Refresh() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && accessToken == "" {
+				t.Fatal("Refresh() returned an empty access token")
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+	"strings"
+)
+
+// AssignRole grants the role to the user, creating the role if it doesn't
+// exist yet. Assigning a role the user already has is a no-op.
+//
+// The method returns ErrInvalidRole for an empty role name, or ErrUserNotFound
+// if the user doesn't exist.
+func (a *Auth) AssignRole(ctx context.Context, userID int64, role string) error {
+	const op = "auth.AssignRole"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.String("role", role))
+
+	log.Info("assigning role")
+
+	role, err := normalizeRole(role)
+	if err != nil {
+		return opError(op, err)
+	}
+
+	if _, err := a.userProvider.UserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if err := a.roles.AssignRole(ctx, userID, role); err != nil {
+		log.Error("failed to assign role", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	a.flushAdmin(userID)
+
+	log.Info("role assigned")
+
+	return nil
+}
+
+// RevokeRole removes the role from the user. Revoking a role the user
+// doesn't have is a no-op.
+//
+// The method returns ErrInvalidRole for an empty role name.
+func (a *Auth) RevokeRole(ctx context.Context, userID int64, role string) error {
+	const op = "auth.RevokeRole"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.String("role", role))
+
+	log.Info("revoking role")
+
+	role, err := normalizeRole(role)
+	if err != nil {
+		return opError(op, err)
+	}
+
+	if err := a.roles.RevokeRole(ctx, userID, role); err != nil {
+		log.Error("failed to revoke role", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	a.flushAdmin(userID)
+
+	log.Info("role revoked")
+
+	return nil
+}
+
+// UserRoles returns the names of the roles assigned to the user.
+func (a *Auth) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	const op = "auth.UserRoles"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	log.Info("getting user roles")
+
+	roles, err := a.roles.UserRoles(ctx, userID)
+	if err != nil {
+		log.Error("failed to get user roles", slog.String("error", err.Error()))
+
+		return nil, opError(op, err)
+	}
+
+	return roles, nil
+}
+
+// GrantScope grants the scope to every user with the role, creating the role
+// if it doesn't exist yet. Scopes are embedded in access tokens issued from
+// then on.
+//
+// The method returns ErrInvalidRole for an empty role name, or
+// ErrInvalidScope for a scope that isn't a valid OAuth 2.0 scope token.
+func (a *Auth) GrantScope(ctx context.Context, role, scope string) error {
+	const op = "auth.GrantScope"
+
+	log := a.log.With(slog.String("op", op), slog.String("role", role), slog.String("scope", scope))
+
+	log.Info("granting scope")
+
+	role, err := normalizeRole(role)
+	if err != nil {
+		return opError(op, err)
+	}
+
+	if !validScope(scope) {
+		return opError(op, ErrInvalidScope)
+	}
+
+	if err := a.roles.GrantScope(ctx, role, scope); err != nil {
+		log.Error("failed to grant scope", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("scope granted")
+
+	return nil
+}
+
+// RevokeScope removes the scope from the role. Revoking a scope the role
+// doesn't have is a no-op. Tokens already issued keep the scope until they
+// expire.
+//
+// The method returns ErrInvalidRole for an empty role name.
+func (a *Auth) RevokeScope(ctx context.Context, role, scope string) error {
+	const op = "auth.RevokeScope"
+
+	log := a.log.With(slog.String("op", op), slog.String("role", role), slog.String("scope", scope))
+
+	log.Info("revoking scope")
+
+	role, err := normalizeRole(role)
+	if err != nil {
+		return opError(op, err)
+	}
+
+	if err := a.roles.RevokeScope(ctx, role, scope); err != nil {
+		log.Error("failed to revoke scope", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("scope revoked")
+
+	return nil
+}
+
+// HasScope reports whether the token the claims were parsed from grants the
+// required scope.
+func HasScope(claims models.TokenClaims, required string) bool {
+	return slices.Contains(claims.Scopes, required)
+}
+
+// validScope reports whether scope is a scope token as defined by RFC 6749:
+// non-empty printable ASCII without spaces, double quotes or backslashes.
+func validScope(scope string) bool {
+	if scope == "" {
+		return false
+	}
+
+	for i := 0; i < len(scope); i++ {
+		if c := scope[i]; c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func normalizeRole(role string) (string, error) {
+	role = strings.TrimSpace(role)
+	if role == "" {
+		return "", ErrInvalidRole
+	}
+
+	return role, nil
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sync"
+)
+
+// sessionEventBuffer is how many events a watcher may fall behind by before
+// it is dropped.
+const sessionEventBuffer = 64
+
+// WatchSessions streams the user's session events, or every user's if userID
+// is zero, as they happen on this instance, until ctx is cancelled. The
+// channel is closed once the watch ends. actorID is the user asking, who may
+// only watch their own sessions unless they are an admin.
+//
+// Events are never waited on: a watcher falling more than a buffer's worth of
+// events behind is dropped and its channel closed while ctx is still live, so
+// that a slow consumer doesn't hold up logins. Consumers should then resync
+// with ListSessions and watch again. Without session storage the channel
+// only closes on cancellation.
+//
+// The method returns ErrInvalidUserID if actorID isn't positive or userID is
+// negative, or ErrPermissionDenied if the actor may not watch userID.
+func (a *Auth) WatchSessions(ctx context.Context, actorID, userID int64) (<-chan models.SessionEvent, error) {
+	const op = "auth.WatchSessions"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("actor_id", actorID), slog.Int64("user_id", userID))
+
+	if actorID <= 0 || userID < 0 {
+		log.Warn("invalid user id")
+
+		return nil, opError(op, ErrInvalidUserID)
+	}
+
+	if actorID != userID {
+		isAdmin, err := a.IsAdmin(ctx, actorID)
+		if err != nil {
+			log.Error("failed to check actor", slog.String("error", err.Error()))
+
+			return nil, opError(op, err)
+		}
+
+		if !isAdmin {
+			log.Warn("actor is not an admin")
+
+			return nil, opError(op, ErrPermissionDenied)
+		}
+	}
+
+	log.Info("watching sessions")
+
+	w := a.sessionEvents.subscribe(userID)
+
+	go func() {
+		<-ctx.Done()
+		a.sessionEvents.unsubscribe(w)
+	}()
+
+	return w.events, nil
+}
+
+// publishSessionEvent hands the event to the watchers of its user and of all
+// users, dropping the ones whose buffer is full.
+func (a *Auth) publishSessionEvent(event models.SessionEvent) {
+	if dropped := a.sessionEvents.publish(event); dropped > 0 {
+		a.log.Warn("dropped slow session watchers",
+			slog.Int64("user_id", event.UserID),
+			slog.Int("count", dropped),
+		)
+	}
+}
+
+// sessionHub fans session events out to watchers. The zero value is ready to
+// use.
+type sessionHub struct {
+	mu       sync.Mutex
+	watchers map[int64]map[*sessionWatcher]struct{}
+}
+
+type sessionWatcher struct {
+	userID int64
+	events chan models.SessionEvent
+}
+
+func (h *sessionHub) subscribe(userID int64) *sessionWatcher {
+	w := &sessionWatcher{
+		userID: userID,
+		events: make(chan models.SessionEvent, sessionEventBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.watchers == nil {
+		h.watchers = make(map[int64]map[*sessionWatcher]struct{})
+	}
+
+	if h.watchers[userID] == nil {
+		h.watchers[userID] = make(map[*sessionWatcher]struct{})
+	}
+
+	h.watchers[userID][w] = struct{}{}
+
+	return w
+}
+
+// unsubscribe removes the watcher and closes its channel, unless it has
+// already been dropped.
+func (h *sessionHub) unsubscribe(w *sessionWatcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(w)
+}
+
+// publish returns the number of watchers dropped for being too slow.
+func (h *sessionHub) publish(event models.SessionEvent) (dropped int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, userID := range []int64{event.UserID, 0} {
+		for w := range h.watchers[userID] {
+			select {
+			case w.events <- event:
+			default:
+				h.remove(w)
+				dropped++
+			}
+		}
+	}
+
+	return dropped
+}
+
+// remove must be called with mu held.
+func (h *sessionHub) remove(w *sessionWatcher) {
+	watchers, ok := h.watchers[w.userID]
+	if !ok {
+		return
+	}
+
+	if _, ok := watchers[w]; !ok {
+		return
+	}
+
+	delete(watchers, w)
+	if len(watchers) == 0 {
+		delete(h.watchers, w.userID)
+	}
+
+	close(w.events)
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/requestmeta"
+	"sso/internal/storage"
+	"time"
+)
+
+// sessionTouchInterval limits how often validating a token updates its
+// session's last-seen time, so that not every request writes to the storage.
+const sessionTouchInterval = time.Minute
+
+// ListSessions returns the user's active sessions, most recently used first.
+func (a *Auth) ListSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "auth.ListSessions"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	if a.sessions == nil {
+		return nil, nil
+	}
+
+	sessions, err := a.sessions.ListSessions(ctx, userID)
+	if err != nil {
+		log.Error("failed to list sessions", slog.String("error", err.Error()))
+
+		return nil, opError(op, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs the session out: its access tokens stop validating and
+// its refresh tokens can no longer be redeemed.
+//
+// The method returns ErrSessionNotFound if the session doesn't exist.
+func (a *Auth) RevokeSession(ctx context.Context, sessionID string) error {
+	const op = "auth.RevokeSession"
+
+	log := a.log.With(slog.String("op", op), slog.String("sid", sessionID))
+
+	log.Info("revoking session")
+
+	if a.sessions == nil {
+		return opError(op, ErrSessionNotFound)
+	}
+
+	if err := a.sessions.RevokeSession(ctx, sessionID); err != nil {
+		log.Error("failed to revoke session", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("session revoked")
+
+	a.publishRevokedSession(ctx, sessionID)
+
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere, say after their account
+// was compromised: every session and refresh token of theirs is revoked, and
+// their access tokens stop validating, including ones without a session.
+// Tokens issued within the same second as the revocation may be rejected as
+// well, since token issue times only have second precision. The user can log
+// in again right away. The revocation is recorded in the audit log with the
+// caller as its actor, and counts towards the caller's login rate limit.
+//
+// The method returns ErrInvalidUserID if userID isn't positive,
+// ErrRateLimited if the caller exceeded the rate limit, or ErrUserNotFound if
+// the user doesn't exist.
+func (a *Auth) RevokeAllSessions(ctx context.Context, userID int64) error {
+	const op = "auth.RevokeAllSessions"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	if actor, ok := ClaimsFromContext(ctx); ok {
+		log = log.With(slog.Int64("actor_id", actor.UserID))
+	}
+
+	log.Info("revoking all sessions")
+
+	if userID <= 0 {
+		log.Warn("invalid user id")
+
+		return opError(op, ErrInvalidUserID)
+	}
+
+	if err := a.checkRateLimit(ctx); err != nil {
+		return opError(op, err)
+	}
+
+	if err := a.revokeUserTokens(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to revoke tokens", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("all sessions revoked")
+
+	a.recordEvent(ctx, models.AuthEventSessionsRevoked, userID, "")
+
+	return nil
+}
+
+// revokeUserTokens revokes every session and token of the user, so that
+// their access tokens stop validating whether they carry a session or not,
+// and tells the user's session watchers.
+func (a *Auth) revokeUserTokens(ctx context.Context, userID int64) error {
+	now := a.clock.Now()
+
+	if err := a.tokenRevoker.RevokeUserTokens(ctx, userID, now); err != nil {
+		return err
+	}
+
+	a.publishSessionEvent(models.SessionEvent{
+		Type:   models.SessionEventRevokedAll,
+		UserID: userID,
+		At:     now,
+	})
+
+	return nil
+}
+
+// checkTokensRevoked returns ErrTokenRevoked if the token was issued before
+// all of its user's tokens were revoked, or the user has been deleted. Only
+// tokens no session check covers need it, since RevokeAllSessions revokes the
+// sessions too.
+func (a *Auth) checkTokensRevoked(ctx context.Context, claims models.TokenClaims) error {
+	user, err := a.userProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrTokenRevoked
+		}
+
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if claims.IssuedAt.Before(user.TokensRevokedAt) {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// startSession records a new session for the user on the calling device and
+// returns its ID, or an empty ID if sessions aren't tracked.
+func (a *Auth) startSession(ctx context.Context, userID int64, appID int) (string, error) {
+	if a.sessions == nil {
+		return "", nil
+	}
+
+	id, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	meta := requestmeta.FromContext(ctx)
+	now := a.clock.Now()
+
+	err = a.sessions.SaveSession(ctx, models.Session{
+		ID:         id,
+		UserID:     userID,
+		AppID:      appID,
+		UserAgent:  meta.UserAgent,
+		IP:         meta.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save session: %w", err)
+	}
+
+	a.publishSessionEvent(models.SessionEvent{
+		Type:      models.SessionEventCreated,
+		SessionID: id,
+		UserID:    userID,
+		AppID:     appID,
+		At:        now,
+	})
+
+	return id, nil
+}
+
+// publishRevokedSession looks up the owner of a revoked session to tell its
+// watchers. A failed lookup only costs the event.
+func (a *Auth) publishRevokedSession(ctx context.Context, sessionID string) {
+	session, err := a.sessions.Session(ctx, sessionID)
+	if err != nil {
+		a.log.Warn("failed to get revoked session", slog.String("sid", sessionID), slog.String("error", err.Error()))
+
+		return
+	}
+
+	a.publishSessionEvent(models.SessionEvent{
+		Type:      models.SessionEventRevoked,
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		AppID:     session.AppID,
+		At:        a.clock.Now(),
+	})
+}
+
+// checkSession returns ErrTokenRevoked if the session has been revoked and
+// otherwise marks it as used. Tokens without a session, issued before
+// sessions were tracked, pass.
+func (a *Auth) checkSession(ctx context.Context, sessionID string) error {
+	if a.sessions == nil || sessionID == "" {
+		return nil
+	}
+
+	session, err := a.sessions.Session(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return ErrTokenRevoked
+		}
+
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if session.Revoked {
+		return ErrTokenRevoked
+	}
+
+	now := a.clock.Now()
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		if err := a.sessions.TouchSession(ctx, sessionID, now); err != nil {
+			a.log.Warn("failed to touch session", slog.String("sid", sessionID), slog.String("error", err.Error()))
+		}
+	}
+
+	return nil
+}
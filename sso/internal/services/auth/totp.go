@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/secretbox"
+	"sso/internal/lib/totp"
+	"time"
+)
+
+const totpIssuer = "sso"
+
+// EnableTOTP generates a new TOTP secret for the user and enables two-factor
+// authentication. The returned otpauth URL can be rendered as a QR code for
+// authenticator apps. Calling it again replaces the previous secret.
+//
+// The method returns ErrTOTPNotConfigured if no encryption key is set, or
+// ErrUserNotFound if the user doesn't exist.
+func (a *Auth) EnableTOTP(ctx context.Context, userID int64) (secret string, otpauthURL string, err error) {
+	const op = "auth.EnableTOTP"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	log.Info("enabling totp")
+
+	if len(a.totpKey) == 0 {
+		log.Error("totp encryption key is not configured")
+
+		return "", "", opError(op, ErrTOTPNotConfigured)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return "", "", opError(op, err)
+	}
+
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		log.Error("failed to generate totp secret", slog.String("error", err.Error()))
+
+		return "", "", opError(op, err)
+	}
+
+	encrypted, err := secretbox.Encrypt(a.totpKey, []byte(secret))
+	if err != nil {
+		log.Error("failed to encrypt totp secret", slog.String("error", err.Error()))
+
+		return "", "", opError(op, err)
+	}
+
+	if err := a.totpStore.SetTOTPSecret(ctx, userID, encrypted); err != nil {
+		log.Error("failed to save totp secret", slog.String("error", err.Error()))
+
+		return "", "", opError(op, err)
+	}
+
+	log.Info("totp enabled")
+
+	return secret, totp.URL(totpIssuer, user.Email, secret), nil
+}
+
+// DisableTOTP turns off two-factor authentication for the user.
+func (a *Auth) DisableTOTP(ctx context.Context, userID int64) error {
+	const op = "auth.DisableTOTP"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	log.Info("disabling totp")
+
+	if err := a.totpStore.SetTOTPSecret(ctx, userID, nil); err != nil {
+		log.Error("failed to remove totp secret", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("totp disabled")
+
+	return nil
+}
+
+// LoginWithTOTP authenticates a user with two-factor authentication enabled
+// and returns a token for the given app ID.
+//
+// The method returns ErrInvalidCredentials if the email or password is wrong,
+// or ErrInvalidTOTPCode if the code doesn't match.
+func (a *Auth) LoginWithTOTP(ctx context.Context, email, password, code string, appID int) (token string, err error) {
+	const op = "auth.LoginWithTOTP"
+
+	defer a.padLogin(ctx, time.Now())
+
+	log := a.log.With(slog.String("op", op), a.emailAttr("username", email))
+
+	log.Info("attempting to login user")
+
+	if code == "" {
+		return "", opError(op, ErrInvalidTOTPCode)
+	}
+
+	user, app, amr, err := a.authenticate(ctx, email, password, code, appID)
+	if err != nil {
+		a.recordLoginFailure(ctx, err)
+
+		return "", opError(op, err)
+	}
+
+	fingerprint, err := a.loginFingerprint(ctx, user, app)
+	if err != nil {
+		return "", opError(op, err)
+	}
+
+	sessionID, err := a.startSession(ctx, user.ID, app.ID)
+	if err != nil {
+		log.Error("failed to start session", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	token, _, err = a.newToken(ctx, user, app, sessionID, amr, fingerprint)
+	if err != nil {
+		log.Error("failed to create token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if err := a.saveOutboxEvent(ctx, models.OutboxEventLogin, user.ID, loginPayload{AppID: app.ID}); err != nil {
+		log.Error("failed to save outbox event", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	log.Info("user logged in successfully")
+
+	a.recordEvent(ctx, models.AuthEventLogin, user.ID, "")
+	a.onLogin(ctx, user.ID, app.ID)
+
+	return token, nil
+}
+
+// verifyTOTP checks code against the user's TOTP secret and reports whether
+// it did. Users without two-factor authentication pass regardless of code.
+func (a *Auth) verifyTOTP(ctx context.Context, user models.User, code string) (verified bool, err error) {
+	encrypted, err := a.totpStore.TOTPSecret(ctx, user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get totp secret: %w", err)
+	}
+
+	if encrypted == nil {
+		return false, nil
+	}
+
+	if code == "" {
+		a.log.Info("totp code required", slog.Int64("user_id", user.ID))
+
+		return false, ErrTOTPRequired
+	}
+
+	secret, err := secretbox.Decrypt(a.totpKey, encrypted)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+
+	if !totp.Validate(code, string(secret), a.clock.Now()) {
+		a.log.Warn("invalid totp code", slog.Int64("user_id", user.ID))
+
+		return false, ErrInvalidTOTPCode
+	}
+
+	return true, nil
+}
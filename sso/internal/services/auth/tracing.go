@@ -0,0 +1,42 @@
+package auth
+
+import "context"
+
+// Tracer starts the spans Auth operations are traced with. See NewOTelTracer
+// for the OpenTelemetry implementation.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer.
+type Span interface {
+	// RecordError records err on the span and marks it as failed.
+	RecordError(err error)
+	End()
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) RecordError(error) {}
+
+func (noopSpan) End() {}
+
+// startSpan starts a span named name as a child of the span in ctx. The
+// returned function ends it, recording *err if it is non-nil.
+func (a *Auth) startSpan(ctx context.Context, name string) (context.Context, func(err *error)) {
+	ctx, span := a.tracer.Start(ctx, name)
+
+	return ctx, func(err *error) {
+		if err != nil && *err != nil {
+			span.RecordError(*err)
+		}
+
+		span.End()
+	}
+}
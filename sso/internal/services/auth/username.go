@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"log/slog"
+	"strings"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 32
+)
+
+// isEmail reports whether a login identifier is an email rather than a
+// username. Usernames can't contain "@", so the two never overlap.
+func isEmail(identifier string) bool {
+	return strings.Contains(identifier, "@")
+}
+
+// normalizeEmail returns the form emails are stored and looked up in: trimmed
+// and lowercased, so that addresses differing only in case match.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeIdentifier normalizes a login identifier if it is an email.
+// Usernames are case-sensitive and kept as they are.
+func normalizeIdentifier(identifier string) string {
+	if isEmail(identifier) {
+		return normalizeEmail(identifier)
+	}
+
+	return identifier
+}
+
+// validUsername reports whether username is 3 to 32 ASCII letters, digits,
+// dots, dashes or underscores.
+func validUsername(username string) bool {
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return false
+	}
+
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// identifierAttr returns the log attribute for a login identifier, masking
+// emails if email redaction is enabled.
+func (a *Auth) identifierAttr(identifier string) slog.Attr {
+	if isEmail(identifier) {
+		return a.emailAttr("username", identifier)
+	}
+
+	return slog.String("username", identifier)
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+	"strings"
+)
+
+// maxListUsersLimit caps the page size of ListUsers.
+const maxListUsersLimit = 100
+
+// ListUsers returns a page of users matching the filter along with the total
+// number of matching users. Password hashes are never included. Limits
+// outside of 1..100 are clamped to 100.
+func (a *Auth) ListUsers(ctx context.Context, limit, offset int, filter models.UserFilter) ([]models.User, int64, error) {
+	const op = "auth.ListUsers"
+
+	log := a.log.With(slog.String("op", op), slog.Int("limit", limit), slog.Int("offset", offset))
+
+	log.Info("listing users")
+
+	if limit <= 0 || limit > maxListUsersLimit {
+		limit = maxListUsersLimit
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	// Stored emails are lowercase.
+	filter.EmailContains = strings.ToLower(filter.EmailContains)
+
+	users, total, err := a.userProvider.ListUsers(ctx, filter, limit, offset)
+	if err != nil {
+		log.Error("failed to list users", slog.String("error", err.Error()))
+
+		return nil, 0, opError(op, err)
+	}
+
+	for i := range users {
+		users[i].PassHash = nil
+	}
+
+	log.Info("users listed", slog.Int("count", len(users)), slog.Int64("total", total))
+
+	return users, total, nil
+}
+
+// UserExists reports whether an email is registered, without loading the
+// user. Deleted users don't count.
+//
+// As the answer reveals registered emails, calls share the login rate limit
+// keyed by ratelimit.WithKey; expose it to clients only through a rate-limited
+// or admin-only path. The method returns ErrRateLimited once the limit is hit.
+func (a *Auth) UserExists(ctx context.Context, email string) (bool, error) {
+	const op = "auth.UserExists"
+
+	email = normalizeEmail(email)
+
+	log := a.log.With(slog.String("op", op), a.emailAttr("email", email))
+
+	log.Info("checking if user exists")
+
+	if err := a.checkRateLimit(ctx); err != nil {
+		return false, opError(op, err)
+	}
+
+	exists, err := a.userProvider.UserExists(ctx, email)
+	if err != nil {
+		log.Error("failed to check if user exists", slog.String("error", err.Error()))
+
+		return false, opError(op, err)
+	}
+
+	return exists, nil
+}
+
+// ChangeEmail replaces the user's email with newEmail, which then has to be
+// verified again. When email verification is required, the returned token
+// verifies the new address once redeemed with VerifyEmail; otherwise it is
+// empty. Issued access tokens stay valid, as they identify the user by ID.
+//
+// The method returns ErrUserNotFound if the user doesn't exist, or
+// ErrUserExists if newEmail belongs to another user.
+func (a *Auth) ChangeEmail(ctx context.Context, userID int64, newEmail string) (verificationToken string, err error) {
+	const op = "auth.ChangeEmail"
+
+	newEmail = normalizeEmail(newEmail)
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), a.emailAttr("email", newEmail))
+
+	log.Info("changing email")
+
+	v := a.newValidator()
+	v.email("email", newEmail)
+	if err := v.err(); err != nil {
+		log.Warn("invalid email", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return "", opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if user.Email == newEmail {
+		log.Info("email unchanged")
+
+		return "", nil
+	}
+
+	if err := a.userSaver.UpdateEmail(ctx, userID, newEmail); err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			log.Warn("email is taken", slog.String("error", err.Error()))
+
+			return "", opError(op, ErrUserExists)
+		}
+
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return "", opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to update email", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	log.Info("email changed")
+
+	a.recordEvent(ctx, models.AuthEventEmailChange, userID, "")
+
+	if !a.requireEmailVerification {
+		return "", nil
+	}
+
+	verificationToken, err = a.issueVerificationToken(ctx, userID)
+	if err != nil {
+		log.Error("failed to issue verification token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	return verificationToken, nil
+}
+
+// SetUserActive disables or re-enables the user. Disabled users can't log in
+// or refresh tokens, failing with ErrAccountDisabled, and disabling revokes
+// their sessions and tokens like RevokeAllSessions. Unlike a deletion,
+// disabling keeps the account intact: once re-enabled, the user logs in with
+// their existing password.
+//
+// The method returns ErrInvalidUserID if userID isn't positive, or
+// ErrUserNotFound if the user doesn't exist or has been deleted.
+func (a *Auth) SetUserActive(ctx context.Context, userID int64, active bool) error {
+	const op = "auth.SetUserActive"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Bool("active", active))
+
+	log.Info("setting user active")
+
+	if userID <= 0 {
+		log.Warn("invalid user id")
+
+		return opError(op, ErrInvalidUserID)
+	}
+
+	if err := a.userSaver.SetUserActive(ctx, userID, active); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to set user active", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	if !active {
+		if err := a.revokeUserTokens(ctx, userID); err != nil {
+			log.Error("failed to revoke tokens", slog.String("error", err.Error()))
+
+			return opError(op, err)
+		}
+	}
+
+	log.Info("user active set")
+
+	return nil
+}
+
+// DeleteUser soft-deletes the user and revokes their sessions and tokens. The
+// user can no longer log in, but their record is kept for auditing.
+//
+// The method returns ErrUserNotFound if the user doesn't exist or has already
+// been deleted.
+func (a *Auth) DeleteUser(ctx context.Context, userID int64) error {
+	const op = "auth.DeleteUser"
+
+	if err := a.deleteUser(ctx, op, userID, false); err != nil {
+		return opError(op, err)
+	}
+
+	return nil
+}
+
+// EraseUser permanently removes the user and everything referencing them,
+// e.g. to honour an erasure request. Soft-deleted users can be erased too.
+//
+// The method returns ErrUserNotFound if the user doesn't exist.
+func (a *Auth) EraseUser(ctx context.Context, userID int64) error {
+	const op = "auth.EraseUser"
+
+	if err := a.deleteUser(ctx, op, userID, true); err != nil {
+		return opError(op, err)
+	}
+
+	return nil
+}
+
+func (a *Auth) deleteUser(ctx context.Context, op string, userID int64, hardDelete bool) error {
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Bool("hard_delete", hardDelete))
+
+	log.Info("deleting user")
+
+	// Soft-deleted users have nothing left to revoke; erasing them removes
+	// their sessions and refresh tokens along with them.
+	if err := a.revokeUserTokens(ctx, userID); err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		log.Error("failed to revoke tokens", slog.String("error", err.Error()))
+
+		return err
+	}
+
+	var err error
+	if hardDelete {
+		err = a.userSaver.EraseUser(ctx, userID)
+	} else {
+		err = a.userSaver.DeleteUser(ctx, userID, a.clock.Now())
+	}
+
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return ErrUserNotFound
+		}
+
+		log.Error("failed to delete user", slog.String("error", err.Error()))
+
+		return err
+	}
+
+	a.flushAdmin(userID)
+
+	log.Info("user deleted")
+
+	return nil
+}
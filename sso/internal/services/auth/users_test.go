@@ -0,0 +1,130 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"sso/internal/services/auth"
+	"testing"
+)
+
+func TestUserRemovalRevokesAccessTokens(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		remove func(a *auth.Auth, userID int64) error
+	}{
+		{
+			name: "disable",
+			remove: func(a *auth.Auth, userID int64) error {
+				return a.SetUserActive(ctx, userID, false)
+			},
+		},
+		{
+			name: "delete",
+			remove: func(a *auth.Auth, userID int64) error {
+				return a.DeleteUser(ctx, userID)
+			},
+		},
+		{
+			name: "erase",
+			remove: func(a *auth.Auth, userID int64) error {
+				return a.EraseUser(ctx, userID)
+			},
+		},
+	}
+
+	for _, sessions := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			if sessions {
+				name += " with sessions"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				s := newTestStorage(t)
+				a := newTestAuth(t, s, func(cfg *auth.Config) {
+					if sessions {
+						cfg.Sessions = s
+					}
+				})
+
+				userID := registerUser(t, a, testEmail)
+
+				token, err := a.Login(ctx, testEmail, testPassword, testAppID)
+				if err != nil {
+					t.Fatalf("failed to login: %v", err)
+				}
+
+				if _, err := a.ValidateToken(ctx, token); err != nil {
+					t.Fatalf("ValidateToken() before removal error = %v", err)
+				}
+
+				if err := tt.remove(a, userID); err != nil {
+					t.Fatalf("failed to remove user: %v", err)
+				}
+
+				if _, err := a.ValidateToken(ctx, token); !errors.Is(err, auth.ErrTokenRevoked) {
+					t.Fatalf("ValidateToken() after removal error = %v, want %v", err, auth.ErrTokenRevoked)
+				}
+			})
+		}
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	a := newTestAuth(t, s, func(cfg *auth.Config) {
+		cfg.BootstrapFirstAdmin = true
+	})
+
+	adminID := registerUser(t, a, "admin@example.com")
+	userID := registerUser(t, a, testEmail)
+	deletedID := registerUser(t, a, "deleted@example.com")
+
+	if err := a.DeleteUser(ctx, deletedID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		userID  int64
+		want    bool
+		wantErr error
+	}{
+		{name: "admin", userID: adminID, want: true},
+		{name: "regular user", userID: userID},
+		{name: "unknown user", userID: deletedID + 1, wantErr: auth.ErrUserNotFound},
+		{name: "deleted user", userID: deletedID, wantErr: auth.ErrUserNotFound},
+		{name: "invalid user id", userID: 0, wantErr: auth.ErrInvalidUserID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.IsAdmin(ctx, tt.userID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("IsAdmin() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("IsAdmin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("storage failure", func(t *testing.T) {
+		s := newTestStorage(t)
+		a := newTestAuth(t, s, nil)
+		userID := registerUser(t, a, testEmail)
+
+		if err := s.Close(); err != nil {
+			t.Fatalf("failed to close storage: %v", err)
+		}
+
+		_, err := a.IsAdmin(ctx, userID)
+		if err == nil || errors.Is(err, auth.ErrUserNotFound) {
+			t.Fatalf("IsAdmin() error = %v, want a storage error", err)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/services/auth"
+	"testing"
+	"time"
+)
+
+func TestValidateTokenRejectsHS256ForgeryForRS256Apps(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	keys, err := jwt.NewKeySet("test", key, nil)
+	if err != nil {
+		t.Fatalf("failed to create key set: %v", err)
+	}
+
+	a := newTestAuth(t, s, func(cfg *auth.Config) { cfg.Keys = keys })
+	userID := registerUser(t, a, testEmail)
+
+	tests := []struct {
+		name    string
+		alg     string
+		wantErr error
+	}{
+		// Apps without a signing algorithm default to RS256 when keys are
+		// configured.
+		{name: "default alg", alg: "", wantErr: auth.ErrInvalidToken},
+		{name: "RS256", alg: jwt.AlgRS256, wantErr: auth.ErrInvalidToken},
+		{name: "HS256", alg: jwt.AlgHS256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appID, err := s.SaveApp(ctx, "app "+tt.name, "secret "+tt.name)
+			if err != nil {
+				t.Fatalf("failed to save app: %v", err)
+			}
+
+			if tt.alg != "" {
+				if err := s.UpdateAppSigningAlg(ctx, appID, tt.alg); err != nil {
+					t.Fatalf("failed to set signing alg: %v", err)
+				}
+			}
+
+			app, err := s.App(ctx, appID)
+			if err != nil {
+				t.Fatalf("failed to get app: %v", err)
+			}
+
+			// Anyone knowing the app secret can sign an HS256 token.
+			app.SigningAlg = jwt.AlgHS256
+
+			forged, err := jwt.NewToken(models.User{ID: userID, Email: testEmail}, app, time.Hour, nil, []string{"admin"}, nil, nil, "", "", "", 0, nil)
+			if err != nil {
+				t.Fatalf("failed to sign token: %v", err)
+			}
+
+			if _, err := a.ValidateToken(ctx, forged); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+			}
+
+			legit, err := a.Login(ctx, testEmail, testPassword, appID)
+			if err != nil {
+				t.Fatalf("failed to login: %v", err)
+			}
+
+			if _, err := a.ValidateToken(ctx, legit); err != nil {
+				t.Fatalf("ValidateToken() of an issued token error = %v", err)
+			}
+		})
+	}
+}
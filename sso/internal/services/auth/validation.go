@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"sso/internal/lib/passhash"
+	"strings"
+)
+
+const (
+	// maxEmailLength is the longest address RFC 5321 allows in a path.
+	maxEmailLength = 254
+	// maxBcryptPasswordLength is the number of bytes bcrypt looks at; longer
+	// passwords would be silently truncated.
+	maxBcryptPasswordLength = 72
+	// maxPasswordLength bounds the work other hashers do per password.
+	maxPasswordLength = 1024
+)
+
+// maxPasswordBytes returns the size of the longest password accepted, set by
+// the password policy or defaulting to what the hasher can take.
+func (a *Auth) maxPasswordBytes() int {
+	maxBytes := maxPasswordLength
+	if a.passwordPolicy.MaxBytes > 0 {
+		maxBytes = a.passwordPolicy.MaxBytes
+	}
+
+	if _, ok := a.hasher.(passhash.Bcrypt); ok {
+		maxBytes = min(maxBytes, maxBcryptPasswordLength)
+	}
+
+	return maxBytes
+}
+
+// checkPasswordSize returns ErrPasswordTooLong if password is longer than
+// maxPasswordBytes.
+func (a *Auth) checkPasswordSize(password string) error {
+	return passwordSizeError(password, a.maxPasswordBytes())
+}
+
+func passwordSizeError(password string, maxBytes int) error {
+	if len(password) > maxBytes {
+		return fmt.Errorf("%w: must be at most %d bytes long", ErrPasswordTooLong, maxBytes)
+	}
+
+	return nil
+}
+
+// ValidationError reports malformed input, mapping the name of each invalid
+// field to what is wrong with it.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, msg := range e.Fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", field, msg))
+	}
+
+	slices.Sort(fields)
+
+	return "invalid input: " + strings.Join(fields, ", ")
+}
+
+// validator collects field errors for a ValidationError. An oversized
+// password is reported as ErrPasswordTooLong instead, ahead of them.
+type validator struct {
+	strictEmails      bool
+	maxPasswordLength int
+	fields            map[string]string
+	tooLong           error
+}
+
+func (a *Auth) newValidator() *validator {
+	return &validator{strictEmails: a.strictEmails, maxPasswordLength: a.maxPasswordBytes()}
+}
+
+func (v *validator) fail(field, msg string) {
+	if v.fields == nil {
+		v.fields = make(map[string]string)
+	}
+
+	if _, ok := v.fields[field]; !ok {
+		v.fields[field] = msg
+	}
+}
+
+// email checks that email is a single bare address. Without strict checks it
+// only has to contain "@".
+func (v *validator) email(field, email string) {
+	switch {
+	case email == "":
+		v.fail(field, "must not be empty")
+	case len(email) > maxEmailLength:
+		v.fail(field, fmt.Sprintf("must be at most %d characters long", maxEmailLength))
+	case !strings.Contains(email, "@"):
+		v.fail(field, "must be an email address")
+	case v.strictEmails:
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			v.fail(field, "must be an email address")
+		}
+	}
+}
+
+// identifier checks a login identifier, which is an email or a username.
+// Usernames are only checked for length, so that a tightened format doesn't
+// lock out existing users.
+func (v *validator) identifier(field, identifier string) {
+	if isEmail(identifier) {
+		v.email(field, identifier)
+
+		return
+	}
+
+	switch {
+	case identifier == "":
+		v.fail(field, "must not be empty")
+	case len(identifier) > maxEmailLength:
+		v.fail(field, fmt.Sprintf("must be at most %d characters long", maxEmailLength))
+	}
+}
+
+func (v *validator) password(field, password string) {
+	if password == "" {
+		v.fail(field, "must not be empty")
+
+		return
+	}
+
+	if err := passwordSizeError(password, v.maxPasswordLength); err != nil && v.tooLong == nil {
+		v.tooLong = err
+	}
+}
+
+// err returns ErrPasswordTooLong if a password was too long, a
+// *ValidationError if any field failed, nil otherwise.
+func (v *validator) err() error {
+	if v.tooLong != nil {
+		return v.tooLong
+	}
+
+	if len(v.fields) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Fields: v.fields}
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sso/internal/storage"
+	"time"
+)
+
+// defaultVerifyResendCooldown is the least time between two verification
+// emails ResendVerification sends a user, unless configured otherwise.
+const defaultVerifyResendCooldown = time.Minute
+
+// RequestEmailVerification issues a single-use token that verifies the
+// user's email when redeemed with VerifyEmail within the configured
+// verification TTL.
+//
+// The method returns ErrUserNotFound if the user doesn't exist.
+func (a *Auth) RequestEmailVerification(ctx context.Context, userID int64) (verificationToken string, err error) {
+	const op = "auth.RequestEmailVerification"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	log.Info("requesting email verification")
+
+	if _, err := a.userProvider.UserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return "", opError(op, ErrUserNotFound)
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	verificationToken, err = a.issueVerificationToken(ctx, userID)
+	if err != nil {
+		log.Error("failed to issue verification token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	log.Info("email verification requested")
+
+	return verificationToken, nil
+}
+
+// ResendVerification issues a fresh email verification token for the user
+// with the given email, for when the previous one got lost. Earlier tokens
+// stay valid until they expire.
+//
+// To avoid leaking which emails are registered, the method returns an empty
+// token and no error when the user doesn't exist or is already verified.
+// It returns ErrRateLimited if a token was resent to the user within the
+// configured cooldown.
+func (a *Auth) ResendVerification(ctx context.Context, email string) (verificationToken string, err error) {
+	const op = "auth.ResendVerification"
+
+	email = normalizeEmail(email)
+
+	log := a.log.With(slog.String("op", op), a.emailAttr("email", email))
+
+	log.Info("resending email verification")
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.String("error", err.Error()))
+
+			return "", nil
+		}
+
+		log.Error("failed to get user", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if user.IsVerified {
+		log.Info("email already verified", slog.Int64("user_id", user.ID))
+
+		return "", nil
+	}
+
+	now := a.clock.Now()
+
+	marked, err := a.verifyStore.MarkVerificationSent(ctx, user.ID, now, now.Add(-a.verifyResendCooldown))
+	if err != nil {
+		log.Error("failed to mark verification sent", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	if !marked {
+		log.Warn("verification resent too recently", slog.Int64("user_id", user.ID))
+
+		return "", opError(op, ErrRateLimited)
+	}
+
+	verificationToken, err = a.issueVerificationToken(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to issue verification token", slog.String("error", err.Error()))
+
+		return "", opError(op, err)
+	}
+
+	log.Info("email verification resent", slog.Int64("user_id", user.ID))
+
+	return verificationToken, nil
+}
+
+// issueVerificationToken generates a random email verification token for the
+// user and stores its hash.
+func (a *Auth) issueVerificationToken(ctx context.Context, userID int64) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.verifyStore.SaveEmailVerification(ctx, userID, hashOpaqueToken(token), a.clock.Now().Add(a.verifyTTL)); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// VerifyEmail redeems a token issued by RequestEmailVerification and marks
+// the user's email as verified.
+//
+// The method returns ErrInvalidVerification if the token is unknown, already
+// used or expired.
+func (a *Auth) VerifyEmail(ctx context.Context, token string) error {
+	const op = "auth.VerifyEmail"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("verifying email")
+
+	userID, err := a.verifyStore.VerifyEmail(ctx, hashOpaqueToken(token), a.clock.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidVerification) {
+			log.Warn("invalid verification token", slog.String("error", err.Error()))
+
+			return opError(op, ErrInvalidVerification)
+		}
+
+		log.Error("failed to verify email", slog.String("error", err.Error()))
+
+		return opError(op, err)
+	}
+
+	log.Info("email verified", slog.Int64("user_id", userID))
+
+	return nil
+}
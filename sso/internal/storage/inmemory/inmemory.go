@@ -0,0 +1,426 @@
+// Package inmemory implements the user and app storage of the Auth service
+// with maps, so it can be exercised without a database. It returns the same
+// sentinel errors as the SQL backends.
+package inmemory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+type user struct {
+	models.User
+	isAdmin   bool
+	deletedAt time.Time
+	// disabled is kept inverted from models.User.IsActive, so that seeded
+	// users are active by default.
+	disabled bool
+}
+
+func (u *user) deleted() bool {
+	return !u.deletedAt.IsZero()
+}
+
+type Storage struct {
+	mu       sync.RWMutex
+	users    map[int64]*user
+	apps     map[int]models.App
+	nextUser int64
+	nextApp  int
+}
+
+// New returns an empty in-memory storage.
+func New() *Storage {
+	return &Storage{
+		users: make(map[int64]*user),
+		apps:  make(map[int]models.App),
+	}
+}
+
+// SeedUser adds a user, keeping its ID unless it is zero, and returns the ID.
+// The user is made an admin if isAdmin is set.
+func (s *Storage) SeedUser(u models.User, isAdmin bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.ID == 0 {
+		s.nextUser++
+		u.ID = s.nextUser
+	} else if u.ID > s.nextUser {
+		s.nextUser = u.ID
+	}
+
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+
+	if u.UpdatedAt.IsZero() {
+		u.UpdatedAt = u.CreatedAt
+	}
+
+	u.PassHash = slices.Clone(u.PassHash)
+	s.users[u.ID] = &user{User: u, isAdmin: isAdmin}
+
+	return u.ID
+}
+
+// SeedApp adds an app, keeping its ID unless it is zero, and returns the ID.
+func (s *Storage) SeedApp(app models.App) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if app.ID == 0 {
+		s.nextApp++
+		app.ID = s.nextApp
+	} else if app.ID > s.nextApp {
+		s.nextApp = app.ID
+	}
+
+	app.Claims = maps.Clone(app.Claims)
+	s.apps[app.ID] = app
+
+	return app.ID
+}
+
+// SaveUser saves a user and returns its ID. Emails and non-empty usernames
+// must be unique, deleted users included. Of the roles, and the firstUserRoles
+// granted to the first user, only admin is kept, and the outbox events are
+// dropped.
+func (s *Storage) SaveUser(_ context.Context, email, username string, passHash []byte, roles, firstUserRoles []string, _ []models.OutboxEvent) (int64, error) {
+	const op = "storage.inmemory.SaveUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUnique(email, username); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(s.users) == 0 {
+		roles = append(slices.Clone(roles), firstUserRoles...)
+	}
+
+	now := time.Now()
+
+	s.nextUser++
+	s.users[s.nextUser] = &user{User: models.User{
+		ID:        s.nextUser,
+		Email:     email,
+		Username:  username,
+		PassHash:  slices.Clone(passHash),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, isAdmin: slices.Contains(roles, "admin")}
+
+	return s.nextUser, nil
+}
+
+// ImportUsers saves users in one go. It returns one error per record, nil for
+// imported users and ErrUserExists for duplicate emails.
+func (s *Storage) ImportUsers(_ context.Context, users []models.UserImport) ([]error, error) {
+	const op = "storage.inmemory.ImportUsers"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]error, len(users))
+
+	for i, u := range users {
+		if err := s.checkUnique(u.Email, ""); err != nil {
+			results[i] = fmt.Errorf("%s: %w", op, err)
+
+			continue
+		}
+
+		now := time.Now()
+
+		s.nextUser++
+		s.users[s.nextUser] = &user{User: models.User{
+			ID:         s.nextUser,
+			Email:      u.Email,
+			PassHash:   slices.Clone(u.PassHash),
+			IsVerified: u.IsVerified,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}}
+	}
+
+	return results, nil
+}
+
+func (s *Storage) checkUnique(email, username string) error {
+	for _, u := range s.users {
+		if u.Email == email {
+			return storage.ErrUserExists
+		}
+
+		if username != "" && u.Username == username {
+			return storage.ErrUsernameTaken
+		}
+	}
+
+	return nil
+}
+
+// UpdatePassword replaces the password hash of the given user and sets their
+// MustChangePassword flag to mustChange.
+func (s *Storage) UpdatePassword(_ context.Context, userID int64, passHash []byte, mustChange bool) error {
+	const op = "storage.inmemory.UpdatePassword"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	u.PassHash = slices.Clone(passHash)
+	u.MustChangePassword = mustChange
+	u.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// SetPasswordChangeRequired sets whether the given user must change their
+// password.
+func (s *Storage) SetPasswordChangeRequired(_ context.Context, userID int64, required bool) error {
+	const op = "storage.inmemory.SetPasswordChangeRequired"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	u.MustChangePassword = required
+	u.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// SetUserActive enables or disables logging in as the given user.
+func (s *Storage) SetUserActive(_ context.Context, userID int64, active bool) error {
+	const op = "storage.inmemory.SetUserActive"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.deleted() {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	u.disabled = !active
+	u.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// UpdateEmail replaces the email of the given user and marks it unverified.
+func (s *Storage) UpdateEmail(_ context.Context, userID int64, email string) error {
+	const op = "storage.inmemory.UpdateEmail"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.deleted() {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	for id, other := range s.users {
+		if id != userID && other.Email == email {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+	}
+
+	u.Email = email
+	u.IsVerified = false
+	u.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// DeleteUser soft-deletes the user, hiding them from lookups.
+func (s *Storage) DeleteUser(_ context.Context, userID int64, deletedAt time.Time) error {
+	const op = "storage.inmemory.DeleteUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.deleted() {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	u.deletedAt = deletedAt
+
+	return nil
+}
+
+// EraseUser permanently removes the user, including soft-deleted ones.
+func (s *Storage) EraseUser(_ context.Context, userID int64) error {
+	const op = "storage.inmemory.EraseUser"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	delete(s.users, userID)
+
+	return nil
+}
+
+// User returns the user with the given email, skipping deleted users.
+func (s *Storage) User(_ context.Context, email string) (models.User, error) {
+	const op = "storage.inmemory.User"
+
+	return s.findUser(op, func(u *user) bool { return u.Email == email })
+}
+
+// UserByUsername returns the user with the given username, skipping deleted
+// users.
+func (s *Storage) UserByUsername(_ context.Context, username string) (models.User, error) {
+	const op = "storage.inmemory.UserByUsername"
+
+	return s.findUser(op, func(u *user) bool { return username != "" && u.Username == username })
+}
+
+// UserByID returns the user with the given ID, skipping deleted users.
+func (s *Storage) UserByID(_ context.Context, userID int64) (models.User, error) {
+	const op = "storage.inmemory.UserByID"
+
+	return s.findUser(op, func(u *user) bool { return u.ID == userID })
+}
+
+func (s *Storage) findUser(op string, match func(*user) bool) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if !u.deleted() && match(u) {
+			found := u.User
+			found.PassHash = slices.Clone(u.PassHash)
+			found.IsActive = !u.disabled
+
+			return found, nil
+		}
+	}
+
+	return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+}
+
+// UserExists reports whether a user with the given email exists, ignoring
+// deleted users.
+func (s *Storage) UserExists(ctx context.Context, email string) (bool, error) {
+	if _, err := s.User(ctx, email); err != nil {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// IsAdmin reports whether the user with the given ID is an admin.
+func (s *Storage) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	const op = "storage.inmemory.IsAdmin"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[userID]
+	if !ok || u.deleted() {
+		return false, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return u.isAdmin, nil
+}
+
+// ListUsers returns a page of users, excluding deleted ones and password
+// hashes, ordered like the SQL backends, along with the number of matches.
+func (s *Storage) ListUsers(_ context.Context, filter models.UserFilter, limit, offset int) ([]models.User, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []models.User
+	for _, u := range s.users {
+		if !u.deleted() && strings.Contains(u.Email, filter.EmailContains) {
+			found := u.User
+			found.PassHash = nil
+			found.IsActive = !u.disabled
+			matched = append(matched, found)
+		}
+	}
+
+	slices.SortFunc(matched, func(a, b models.User) int {
+		c := a.CreatedAt.Compare(b.CreatedAt)
+		if c == 0 {
+			c = int(a.ID - b.ID)
+		}
+
+		if filter.NewestFirst {
+			return -c
+		}
+
+		return c
+	})
+
+	total := int64(len(matched))
+
+	if offset >= len(matched) {
+		return nil, total, nil
+	}
+
+	matched = matched[offset:]
+	if limit < len(matched) {
+		matched = matched[:limit]
+	}
+
+	return matched, total, nil
+}
+
+// App returns the app with the given ID.
+func (s *Storage) App(_ context.Context, appID int) (models.App, error) {
+	const op = "storage.inmemory.App"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	app, ok := s.apps[appID]
+	if !ok {
+		return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+	}
+
+	app.Claims = maps.Clone(app.Claims)
+
+	return app, nil
+}
+
+// ListApps returns all apps, ordered by ID.
+func (s *Storage) ListApps(_ context.Context) ([]models.App, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	apps := make([]models.App, 0, len(s.apps))
+	for _, app := range s.apps {
+		app.Claims = maps.Clone(app.Claims)
+		apps = append(apps, app)
+	}
+
+	slices.SortFunc(apps, func(a, b models.App) int { return cmp.Compare(a.ID, b.ID) })
+
+	return apps, nil
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PoolConfig tunes the database/sql connection pool. Zero values keep the
+// database/sql defaults: unlimited open connections, two idle connections and
+// no lifetime limits.
+//
+// Recommended settings:
+//   - SQLite allows a single writer even in WAL mode, so extra connections
+//     only help readers: MaxOpenConns 4-8, MaxIdleConns equal to it and
+//     ConnMaxLifetime 0, the database file does not go away.
+//   - PostgreSQL: MaxOpenConns 25, MaxIdleConns 25, ConnMaxLifetime 30m and
+//     ConnMaxIdleTime 5m. Keep MaxOpenConns times the number of replicas
+//     below the server's max_connections.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Apply sets the pool limits on db.
+func (c PoolConfig) Apply(db *sql.DB) {
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+}
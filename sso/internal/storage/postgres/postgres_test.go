@@ -0,0 +1,92 @@
+//go:build postgres
+
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sso/internal/migrator"
+	"sso/internal/storage"
+	"sso/internal/storage/postgres"
+	"sso/internal/storage/sqlite"
+	"testing"
+	"time"
+)
+
+// newTestStorage returns a storage for the migrated database at
+// SSO_TEST_POSTGRES_URL, skipping the test if it isn't set.
+func newTestStorage(t *testing.T) *postgres.Storage {
+	t.Helper()
+
+	dsn := os.Getenv("SSO_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("SSO_TEST_POSTGRES_URL is not set")
+	}
+
+	if err := migrator.RunMigrations(migrator.DriverPostgres, dsn, "../../../migrations/postgres", "", sqlite.Options{}, migrator.Up); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	s, err := postgres.New(dsn, storage.PoolConfig{}, storage.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+func TestSaveUserConflicts(t *testing.T) {
+	ctx := context.Background()
+	passHash := []byte("hash")
+
+	tests := []struct {
+		name     string
+		email    string
+		username string
+		// deleteFirst soft-deletes the existing user before saving.
+		deleteFirst bool
+		wantErr     error
+	}{
+		{name: "new user", email: "other", username: "other"},
+		{name: "duplicate email", email: "user", wantErr: storage.ErrUserExists},
+		{name: "duplicate email of a deleted user", email: "user", deleteFirst: true, wantErr: storage.ErrUserExists},
+		{name: "duplicate username", email: "other", username: "user", wantErr: storage.ErrUsernameTaken},
+	}
+
+	s := newTestStorage(t)
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The database is shared between runs, so every case gets
+			// names of its own.
+			suffix := fmt.Sprintf("%d-%d", time.Now().UnixNano(), i)
+			name := func(s string) string {
+				if s == "" {
+					return ""
+				}
+
+				return s + "-" + suffix
+			}
+
+			userID, err := s.SaveUser(ctx, name("user")+"@example.com", name("user"), passHash, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("failed to save user: %v", err)
+			}
+
+			if tt.deleteFirst {
+				if err := s.DeleteUser(ctx, userID, time.Now()); err != nil {
+					t.Fatalf("failed to delete user: %v", err)
+				}
+			}
+
+			_, err = s.SaveUser(ctx, name(tt.email)+"@example.com", name(tt.username), passHash, nil, nil, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SaveUser() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how storage operations failing with transient errors,
+// such as SQLITE_BUSY or PostgreSQL serialization failures, are retried. The
+// zero value disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for every
+	// subsequent one up to MaxDelay. Delays are jittered by up to half.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts. Zero leaves it uncapped.
+	MaxDelay time.Duration
+}
+
+// Do calls fn until it succeeds, fails with an error transient doesn't
+// accept, or the attempts run out, and returns the last error. It stops
+// waiting as soon as ctx is done.
+func (p RetryPolicy) Do(ctx context.Context, transient func(error) bool, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !transient(err) {
+			return err
+		}
+
+		timer := time.NewTimer(p.delay(attempt))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the jittered delay before the given retry, counting from 1.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if d <= 1 {
+		return d
+	}
+
+	return d/2 + rand.N(d/2)
+}
+
+// RetryValue is Do for operations that return a value.
+func RetryValue[T any](ctx context.Context, p RetryPolicy, transient func(error) bool, fn func() (T, error)) (T, error) {
+	var v T
+
+	err := p.Do(ctx, transient, func() error {
+		var err error
+		v, err = fn()
+
+		return err
+	})
+
+	return v, err
+}
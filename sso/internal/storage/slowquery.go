@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// LogSlowQueries wraps db so that statements taking longer than threshold
+// are logged at warn level along with the storage operation that ran them.
+// Queries returning rows are timed until the first row is available. A
+// non-positive threshold returns db as is.
+func LogSlowQueries(db DB, log *slog.Logger, threshold time.Duration) DB {
+	if threshold <= 0 {
+		return db
+	}
+
+	return &slowQueryDB{DB: db, log: log, threshold: threshold}
+}
+
+type slowQueryDB struct {
+	DB
+	log       *slog.Logger
+	threshold time.Duration
+}
+
+func (d *slowQueryDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer d.observe(ctx, query, time.Now())
+
+	return d.DB.ExecContext(ctx, query, args...)
+}
+
+func (d *slowQueryDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer d.observe(ctx, query, time.Now())
+
+	return d.DB.QueryContext(ctx, query, args...)
+}
+
+func (d *slowQueryDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer d.observe(ctx, query, time.Now())
+
+	return d.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (d *slowQueryDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &slowQueryTx{slowQueryDB: &slowQueryDB{DB: tx, log: d.log, threshold: d.threshold}, tx: tx}, nil
+}
+
+func (d *slowQueryDB) observe(ctx context.Context, query string, start time.Time) {
+	elapsed := time.Since(start)
+	if elapsed < d.threshold {
+		return
+	}
+
+	d.log.WarnContext(ctx, "slow query",
+		slog.String("op", callerOp()),
+		slog.Duration("duration", elapsed),
+		slog.String("query", query),
+	)
+}
+
+// slowQueryTx is a Tx whose statements, and those of its savepoints, are
+// logged by slowQueryDB.
+type slowQueryTx struct {
+	*slowQueryDB
+	tx Tx
+}
+
+func (t *slowQueryTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *slowQueryTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// callerOp names the storage operation running a statement after the "op"
+// constants of the storages, e.g. "storage.sqlite.SaveUser", from the first
+// caller outside this package.
+func callerOp() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+
+	for {
+		frame, more := frames.Next()
+
+		// Function is like "sso/internal/storage/sqlite.(*Storage).SaveUser.func1".
+		name := frame.Function[strings.LastIndex(frame.Function, "/")+1:]
+		if pkg, _, _ := strings.Cut(name, "."); pkg != "storage" {
+			name = strings.Replace(name, "(*Storage).", "", 1)
+
+			parts := strings.Split(name, ".")
+			if len(parts) >= 2 {
+				return "storage." + parts[0] + "." + parts[1]
+			}
+
+			return name
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,2057 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type Storage struct {
+	// db runs the queries: the database, or the transaction of a Storage
+	// passed to a WithTx callback.
+	db    storage.DB
+	sqlDB *sql.DB
+	retry storage.RetryPolicy
+	// inTx is set for a Storage passed to a WithTx callback.
+	inTx bool
+}
+
+// Options tune how SQLite databases are opened, by the storage as well as the
+// migrator, which should use the same ones.
+//
+// The WAL journal mode, the default, lets reads run alongside the single
+// writer, so a migration or a long write doesn't stall the service. Its
+// downsides are the -wal and -shm files kept next to the database, which
+// must be copied along with it in backups, the WAL file growing until it is
+// checkpointed, and not working on network filesystems, where every process
+// opening the database must be on the same host. The journal mode is stored
+// in the database, so opening it with another one switches it for everyone.
+type Options struct {
+	// BusyTimeout is how long writers wait for a locked database instead of
+	// failing with SQLITE_BUSY. Zero keeps the driver default of five
+	// seconds.
+	BusyTimeout time.Duration
+	// JournalMode is the SQLite journal mode, such as WAL or DELETE. Empty
+	// means WAL.
+	JournalMode string
+}
+
+// New creates a new instance of the SQLite storage, opening the database with
+// opts. Operations failing with SQLITE_BUSY or SQLITE_LOCKED even after the
+// busy timeout are retried as retry allows.
+func New(storagePath string, pool storage.PoolConfig, opts Options, retry storage.RetryPolicy) (*Storage, error) {
+	const op = "storage.sqlite.New"
+
+	db, err := sql.Open("sqlite3", DSN(storagePath, opts))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pool.Apply(db)
+
+	return &Storage{db: storage.NewDB(db), sqlDB: db, retry: retry}, nil
+}
+
+// LogSlowQueries makes the storage log statements taking longer than
+// threshold at warn level, see storage.LogSlowQueries. It must be called
+// before the storage is used.
+func (s *Storage) LogSlowQueries(log *slog.Logger, threshold time.Duration) {
+	s.db = storage.LogSlowQueries(s.db, log, threshold)
+}
+
+// SetQueryTimeout bounds every statement of the storage by timeout, see
+// storage.WithQueryTimeout. It must be called before the storage is used.
+func (s *Storage) SetQueryTimeout(timeout time.Duration) {
+	s.db = storage.WithQueryTimeout(s.db, timeout)
+}
+
+// WithTx runs fn in a transaction and commits it if fn returns nil, or rolls
+// it back otherwise. Every method of the Storage passed to fn runs in that
+// transaction; fn must not use any other Storage, nor keep this one after
+// returning. Calling WithTx on it, or a method that needs a transaction of its
+// own, begins a savepoint in the same transaction instead of opening another
+// one, which would block on SQLite's single writer lock.
+//
+// Statements within the transaction aren't retried individually. Instead, the
+// whole transaction is retried on transient errors as the retry policy
+// allows, so fn may run more than once.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx *Storage) error) error {
+	const op = "storage.sqlite.WithTx"
+
+	return s.withRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		if err := fn(&Storage{db: tx, sqlDB: s.sqlDB, inTx: true}); err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// withRetry runs a storage operation under the retry policy.
+func (s *Storage) withRetry(ctx context.Context, fn func() error) error {
+	return s.retry.Do(ctx, isTransient, fn)
+}
+
+func withRetryValue[T any](ctx context.Context, s *Storage, fn func() (T, error)) (T, error) {
+	return storage.RetryValue(ctx, s.retry, isTransient, fn)
+}
+
+// isTransient reports whether err is a lock conflict with another connection
+// that may succeed when retried.
+func isTransient(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// DSN adds the busy timeout and journal mode of opts to storagePath unless it
+// already sets them.
+func DSN(storagePath string, opts Options) string {
+	var params []string
+
+	if !strings.Contains(storagePath, "_busy_timeout=") && opts.BusyTimeout > 0 {
+		params = append(params, fmt.Sprintf("_busy_timeout=%d", opts.BusyTimeout.Milliseconds()))
+	}
+
+	if !strings.Contains(storagePath, "_journal_mode=") {
+		journalMode := opts.JournalMode
+		if journalMode == "" {
+			journalMode = "WAL"
+		}
+
+		params = append(params, "_journal_mode="+journalMode)
+	}
+
+	if len(params) == 0 {
+		return storagePath
+	}
+
+	sep := "?"
+	if strings.Contains(storagePath, "?") {
+		sep = "&"
+	}
+
+	return storagePath + sep + strings.Join(params, "&")
+}
+
+// SaveUser saves a user to the database along with the given roles, creating
+// the ones that don't exist yet, and outbox events, which get the user's ID,
+// and returns its ID. An empty username is stored as NULL. The firstUserRoles
+// are granted as well if no other user exists, deleted ones included.
+func (s *Storage) SaveUser(ctx context.Context, email, username string, passHash []byte, roles, firstUserRoles []string, events []models.OutboxEvent) (int64, error) {
+	const op = "storage.sqlite.SaveUser"
+
+	return withRetryValue(ctx, s, func() (int64, error) {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO users(email, username, pass_hash, created_at, updated_at) VALUES(?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+			email, nullString(username), passHash,
+		)
+		if err != nil {
+			if isUniqueViolation(err) {
+				if isUsernameConflict(err) {
+					return 0, fmt.Errorf("%s: %w", op, storage.ErrUsernameTaken)
+				}
+
+				return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+			}
+
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// Each attempt starts from the given roles, so that a retry doesn't
+		// keep the first user's ones granted by a failed attempt.
+		userRoles := roles
+
+		// The insert holds the database's write lock until the commit, so a
+		// concurrent registration can't also see itself as the only user.
+		if len(firstUserRoles) > 0 {
+			var others bool
+			if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id <> ?)", id).Scan(&others); err != nil {
+				return 0, fmt.Errorf("%s: %w", op, err)
+			}
+
+			if !others {
+				userRoles = append(slices.Clone(roles), firstUserRoles...)
+			}
+		}
+
+		if err := assignRoles(ctx, tx, id, userRoles); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, event := range events {
+			event.UserID = id
+
+			if err := saveOutboxEvent(ctx, tx, event); err != nil {
+				return 0, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return id, nil
+	})
+}
+
+// User returns the user with the given email, skipping deleted users.
+func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
+	const op = "storage.sqlite.User"
+
+	return withRetryValue(ctx, s, func() (models.User, error) {
+		row := s.db.QueryRowContext(ctx, "SELECT id, email, COALESCE(username, ''), pass_hash, is_verified, is_active, must_change_password FROM users WHERE email = ? AND deleted_at IS NULL", email)
+
+		var user models.User
+		if err := row.Scan(&user.ID, &user.Email, &user.Username, &user.PassHash, &user.IsVerified, &user.IsActive, &user.MustChangePassword); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+			}
+
+			return models.User{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return user, nil
+	})
+}
+
+// UserByID returns the user with the given ID, skipping deleted users.
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "storage.sqlite.UserByID"
+
+	return withRetryValue(ctx, s, func() (models.User, error) {
+		row := s.db.QueryRowContext(ctx, "SELECT id, email, COALESCE(username, ''), pass_hash, is_verified, is_active, tokens_revoked_at, must_change_password FROM users WHERE id = ? AND deleted_at IS NULL", userID)
+
+		var (
+			user            models.User
+			tokensRevokedAt sql.NullTime
+		)
+
+		if err := row.Scan(&user.ID, &user.Email, &user.Username, &user.PassHash, &user.IsVerified, &user.IsActive, &tokensRevokedAt, &user.MustChangePassword); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+			}
+
+			return models.User{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		user.TokensRevokedAt = tokensRevokedAt.Time
+
+		return user, nil
+	})
+}
+
+// IsAdmin reports whether the user with the given ID has the admin role.
+func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	const op = "storage.sqlite.IsAdmin"
+
+	return withRetryValue(ctx, s, func() (bool, error) {
+		row := s.db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1
+			              FROM user_roles ur
+			                       JOIN roles r ON r.id = ur.role_id
+			              WHERE ur.user_id = users.id
+			                AND r.name = ?)
+			FROM users
+			WHERE id = ?
+			  AND deleted_at IS NULL`,
+			models.RoleAdmin, userID,
+		)
+
+		var isAdmin bool
+		if err := row.Scan(&isAdmin); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return false, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+			}
+
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return isAdmin, nil
+	})
+}
+
+// App returns the app with the given ID.
+func (s *Storage) App(ctx context.Context, appID int) (models.App, error) {
+	const op = "storage.sqlite.App"
+
+	return withRetryValue(ctx, s, func() (models.App, error) {
+		row := s.db.QueryRowContext(ctx, "SELECT "+appColumns+" FROM apps WHERE id = ?", appID)
+
+		app, err := scanApp(row)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+			}
+
+			return models.App{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return app, nil
+	})
+}
+
+// ListApps returns all apps, ordered by ID.
+func (s *Storage) ListApps(ctx context.Context) ([]models.App, error) {
+	const op = "storage.sqlite.ListApps"
+
+	return withRetryValue(ctx, s, func() ([]models.App, error) {
+		rows, err := s.db.QueryContext(ctx, "SELECT "+appColumns+" FROM apps ORDER BY id")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer rows.Close()
+
+		var apps []models.App
+		for rows.Next() {
+			app, err := scanApp(rows)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			apps = append(apps, app)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return apps, nil
+	})
+}
+
+// appColumns are the columns of apps read by scanApp.
+const appColumns = "id, name, secret, previous_secrets, claims, token_ttl, signing_alg, bind_tokens"
+
+// scanApp reads an app selected with appColumns from row, a *sql.Row or
+// *sql.Rows.
+func scanApp(row interface{ Scan(dest ...any) error }) (models.App, error) {
+	var (
+		app             models.App
+		previousSecrets []byte
+		claims          []byte
+		tokenTTL        sql.NullInt64
+		signingAlg      sql.NullString
+	)
+
+	if err := row.Scan(&app.ID, &app.Name, &app.Secret, &previousSecrets, &claims, &tokenTTL, &signingAlg, &app.BindTokens); err != nil {
+		return models.App{}, err
+	}
+
+	if previousSecrets != nil {
+		if err := json.Unmarshal(previousSecrets, &app.PreviousSecrets); err != nil {
+			return models.App{}, err
+		}
+	}
+
+	if claims != nil {
+		if err := json.Unmarshal(claims, &app.Claims); err != nil {
+			return models.App{}, err
+		}
+	}
+
+	app.TokenTTL = time.Duration(tokenTTL.Int64) * time.Second
+	app.SigningAlg = signingAlg.String
+
+	return app, nil
+}
+
+// SaveRefreshToken stores an issued refresh token, by its hash. An empty
+// SessionID is stored as NULL.
+func (s *Storage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	const op = "storage.sqlite.SaveRefreshToken"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO refresh_tokens(user_id, app_id, session_id, token_hash, expires_at, created_at, device, amr, fingerprint) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			token.UserID, token.AppID, nullString(token.SessionID), token.TokenHash, token.ExpiresAt.UTC(), token.CreatedAt.UTC(), token.Device,
+			strings.Join(token.AMR, " "), token.Fingerprint,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// RefreshToken returns the refresh token with the given hash.
+func (s *Storage) RefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error) {
+	const op = "storage.sqlite.RefreshToken"
+
+	return withRetryValue(ctx, s, func() (models.RefreshToken, error) {
+		row := s.db.QueryRowContext(ctx,
+			"SELECT id, user_id, app_id, COALESCE(session_id, ''), token_hash, expires_at, revoked, created_at, last_used_at, device, amr, fingerprint FROM refresh_tokens WHERE token_hash = ?",
+			tokenHash,
+		)
+
+		var (
+			token                 models.RefreshToken
+			createdAt, lastUsedAt sql.NullTime
+			amr                   string
+		)
+		if err := row.Scan(
+			&token.ID, &token.UserID, &token.AppID, &token.SessionID, &token.TokenHash, &token.ExpiresAt, &token.Revoked,
+			&createdAt, &lastUsedAt, &token.Device, &amr, &token.Fingerprint,
+		); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.RefreshToken{}, fmt.Errorf("%s: %w", op, storage.ErrRefreshTokenNotFound)
+			}
+
+			return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		token.CreatedAt = createdAt.Time
+		token.LastUsedAt = lastUsedAt.Time
+		token.AMR = strings.Fields(amr)
+
+		return token, nil
+	})
+}
+
+// ListRefreshTokens returns the user's refresh tokens that are neither
+// revoked nor expired at now, most recently issued first.
+func (s *Storage) ListRefreshTokens(ctx context.Context, userID int64, now time.Time) ([]models.RefreshToken, error) {
+	const op = "storage.sqlite.ListRefreshTokens"
+
+	return withRetryValue(ctx, s, func() ([]models.RefreshToken, error) {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id, user_id, COALESCE(session_id, ''), token_hash, expires_at, revoked, created_at, last_used_at, device, amr FROM refresh_tokens WHERE user_id = ? AND NOT revoked AND expires_at > ? ORDER BY id DESC",
+			userID, now.UTC(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer rows.Close()
+
+		var tokens []models.RefreshToken
+		for rows.Next() {
+			var (
+				token                 models.RefreshToken
+				createdAt, lastUsedAt sql.NullTime
+				amr                   string
+			)
+			if err := rows.Scan(
+				&token.ID, &token.UserID, &token.SessionID, &token.TokenHash, &token.ExpiresAt, &token.Revoked,
+				&createdAt, &lastUsedAt, &token.Device, &amr,
+			); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			token.CreatedAt = createdAt.Time
+			token.LastUsedAt = lastUsedAt.Time
+			token.AMR = strings.Fields(amr)
+
+			tokens = append(tokens, token)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return tokens, nil
+	})
+}
+
+// TouchRefreshToken records that the refresh token with the given ID was
+// redeemed at usedAt.
+func (s *Storage) TouchRefreshToken(ctx context.Context, id int64, usedAt time.Time) error {
+	const op = "storage.sqlite.TouchRefreshToken"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx, "UPDATE refresh_tokens SET last_used_at = ? WHERE id = ?", usedAt.UTC(), id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// RevokeRefreshTokenByID marks the refresh token with the given ID as
+// revoked.
+func (s *Storage) RevokeRefreshTokenByID(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.RevokeRefreshTokenByID"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrRefreshTokenNotFound)
+		}
+
+		return nil
+	})
+}
+
+// RevokeRefreshToken marks the refresh token with the given hash as revoked.
+func (s *Storage) RevokeRefreshToken(ctx context.Context, tokenHash []byte) error {
+	const op = "storage.sqlite.RevokeRefreshToken"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE token_hash = ?", tokenHash)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrRefreshTokenNotFound)
+		}
+
+		return nil
+	})
+}
+
+// RevokeToken adds the token with the given jti to the revocation list.
+func (s *Storage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "storage.sqlite.RevokeToken"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO revoked_tokens(jti, expires_at) VALUES(?, ?) ON CONFLICT DO NOTHING",
+			jti, expiresAt.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// IsTokenRevoked reports whether the token with the given jti has been revoked.
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	const op = "storage.sqlite.IsTokenRevoked"
+
+	return withRetryValue(ctx, s, func() (bool, error) {
+		row := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti)
+
+		var revoked bool
+		if err := row.Scan(&revoked); err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return revoked, nil
+	})
+}
+
+// DeleteExpiredRevokedTokens removes revocation entries for tokens that
+// expired before the given time and returns how many were removed.
+func (s *Storage) DeleteExpiredRevokedTokens(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.sqlite.DeleteExpiredRevokedTokens"
+
+	return withRetryValue(ctx, s, func() (int64, error) {
+		res, err := s.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < ?", before.UTC())
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return n, nil
+	})
+}
+
+// UpdatePassword replaces the password hash of the user with the given ID and
+// sets their MustChangePassword flag to mustChange.
+func (s *Storage) UpdatePassword(ctx context.Context, userID int64, passHash []byte, mustChange bool) error {
+	const op = "storage.sqlite.UpdatePassword"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE users SET pass_hash = ?, must_change_password = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", passHash, mustChange, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil
+	})
+}
+
+// SetPasswordChangeRequired sets whether the user must change their password,
+// see models.User.MustChangePassword.
+func (s *Storage) SetPasswordChangeRequired(ctx context.Context, userID int64, required bool) error {
+	const op = "storage.sqlite.SetPasswordChangeRequired"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE users SET must_change_password = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", required, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil
+	})
+}
+
+// SetUserActive enables or disables logging in as the given user, skipping
+// deleted users.
+func (s *Storage) SetUserActive(ctx context.Context, userID int64, active bool) error {
+	const op = "storage.sqlite.SetUserActive"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE users SET is_active = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", active, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil
+	})
+}
+
+// UpdateEmail replaces the email of the given user and marks it unverified,
+// discarding verification tokens issued for the previous one.
+func (s *Storage) UpdateEmail(ctx context.Context, userID int64, email string) error {
+	const op = "storage.sqlite.UpdateEmail"
+
+	return s.withRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		res, err := tx.ExecContext(ctx, "UPDATE users SET email = ?, is_verified = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", email, userID)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+			}
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM email_verifications WHERE user_id = ? AND NOT used", userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// RevokeRefreshTokens marks every refresh token of the given user as revoked.
+func (s *Storage) RevokeRefreshTokens(ctx context.Context, userID int64) error {
+	const op = "storage.sqlite.RevokeRefreshTokens"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE user_id = ? AND NOT revoked", userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// RevokeUserTokens revokes every session and refresh token of the user and
+// records revokedAt, before which the user's access tokens no longer
+// validate, all in one transaction.
+func (s *Storage) RevokeUserTokens(ctx context.Context, userID int64, revokedAt time.Time) error {
+	const op = "storage.sqlite.RevokeUserTokens"
+
+	return s.withRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		res, err := tx.ExecContext(ctx, "UPDATE users SET tokens_revoked_at = ? WHERE id = ? AND deleted_at IS NULL", revokedAt.UTC(), userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked = TRUE WHERE user_id = ? AND NOT revoked", userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE user_id = ? AND NOT revoked", userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// SavePasswordReset stores the hash of an issued password-reset token.
+func (s *Storage) SavePasswordReset(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) error {
+	const op = "storage.sqlite.SavePasswordReset"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO password_resets(user_id, token_hash, expires_at) VALUES(?, ?, ?)",
+			userID, tokenHash, expiresAt.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// ConsumePasswordReset marks an unused, unexpired password-reset token as used
+// and returns the ID of the user it was issued to. Marking and checking happen
+// in a single statement, so a token can't be redeemed twice concurrently.
+func (s *Storage) ConsumePasswordReset(ctx context.Context, tokenHash []byte, now time.Time) (int64, error) {
+	const op = "storage.sqlite.ConsumePasswordReset"
+
+	return withRetryValue(ctx, s, func() (int64, error) {
+		row := s.db.QueryRowContext(ctx,
+			"UPDATE password_resets SET used = TRUE WHERE token_hash = ? AND NOT used AND expires_at > ? RETURNING user_id",
+			tokenHash, now.UTC(),
+		)
+
+		var userID int64
+		if err := row.Scan(&userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, fmt.Errorf("%s: %w", op, storage.ErrInvalidResetToken)
+			}
+
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return userID, nil
+	})
+}
+
+// SaveMagicLink stores the hash of an issued magic login link token.
+func (s *Storage) SaveMagicLink(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) error {
+	const op = "storage.sqlite.SaveMagicLink"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO magic_links(user_id, token_hash, expires_at) VALUES(?, ?, ?)",
+			userID, tokenHash, expiresAt.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// ConsumeMagicLink marks an unused, unexpired magic link token as used and
+// returns the ID of the user it was issued to, in a single statement like
+// ConsumePasswordReset.
+func (s *Storage) ConsumeMagicLink(ctx context.Context, tokenHash []byte, now time.Time) (int64, error) {
+	const op = "storage.sqlite.ConsumeMagicLink"
+
+	return withRetryValue(ctx, s, func() (int64, error) {
+		row := s.db.QueryRowContext(ctx,
+			"UPDATE magic_links SET used = TRUE WHERE token_hash = ? AND NOT used AND expires_at > ? RETURNING user_id",
+			tokenHash, now.UTC(),
+		)
+
+		var userID int64
+		if err := row.Scan(&userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, fmt.Errorf("%s: %w", op, storage.ErrInvalidMagicLink)
+			}
+
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return userID, nil
+	})
+}
+
+// LoginAttempts returns the failed login counter for the given email.
+// An email without recorded failures yields a zero value.
+func (s *Storage) LoginAttempts(ctx context.Context, email string) (models.LoginAttempts, error) {
+	const op = "storage.sqlite.LoginAttempts"
+
+	return withRetryValue(ctx, s, func() (models.LoginAttempts, error) {
+		row := s.db.QueryRowContext(ctx, "SELECT failed_count, locked_until FROM login_attempts WHERE email = ?", email)
+
+		attempts := models.LoginAttempts{Email: email}
+
+		var lockedUntil sql.NullTime
+		if err := row.Scan(&attempts.FailedCount, &lockedUntil); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return attempts, nil
+			}
+
+			return models.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		attempts.LockedUntil = lockedUntil.Time
+
+		return attempts, nil
+	})
+}
+
+// IncrementFailedLogins increments the failed login counter for the given
+// email and returns the new value.
+func (s *Storage) IncrementFailedLogins(ctx context.Context, email string) (int, error) {
+	const op = "storage.sqlite.IncrementFailedLogins"
+
+	return withRetryValue(ctx, s, func() (int, error) {
+		row := s.db.QueryRowContext(ctx, `
+			INSERT INTO login_attempts(email, failed_count) VALUES(?, 1)
+			ON CONFLICT(email) DO UPDATE SET failed_count = login_attempts.failed_count + 1
+			RETURNING failed_count`,
+			email,
+		)
+
+		var failed int
+		if err := row.Scan(&failed); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return failed, nil
+	})
+}
+
+// LockAccount locks logins for the given email until the given time and
+// resets the failed login counter.
+func (s *Storage) LockAccount(ctx context.Context, email string, until time.Time) error {
+	const op = "storage.sqlite.LockAccount"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO login_attempts(email, failed_count, locked_until) VALUES(?, 0, ?)
+			ON CONFLICT(email) DO UPDATE SET failed_count = 0, locked_until = excluded.locked_until`,
+			email, until.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// ResetLoginAttempts clears the failed login counter and lock for the given email.
+func (s *Storage) ResetLoginAttempts(ctx context.Context, email string) error {
+	const op = "storage.sqlite.ResetLoginAttempts"
+
+	return s.withRetry(ctx, func() error {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE email = ?", email); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// TOTPSecret returns the encrypted TOTP secret of the given user, or nil if
+// two-factor authentication is not enabled.
+func (s *Storage) TOTPSecret(ctx context.Context, userID int64) ([]byte, error) {
+	const op = "storage.sqlite.TOTPSecret"
+
+	return withRetryValue(ctx, s, func() ([]byte, error) {
+		row := s.db.QueryRowContext(ctx, "SELECT totp_secret FROM users WHERE id = ?", userID)
+
+		var secret []byte
+		if err := row.Scan(&secret); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+			}
+
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return secret, nil
+	})
+}
+
+// SetTOTPSecret stores the encrypted TOTP secret of the given user. A nil
+// secret disables two-factor authentication.
+func (s *Storage) SetTOTPSecret(ctx context.Context, userID int64, encryptedSecret []byte) error {
+	const op = "storage.sqlite.SetTOTPSecret"
+
+	return s.withRetry(ctx, func() error {
+		secret := sql.Null[[]byte]{V: encryptedSecret, Valid: encryptedSecret != nil}
+
+		res, err := s.db.ExecContext(ctx, "UPDATE users SET totp_secret = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", secret, userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil
+	})
+}
+
+// AssignRole grants the role to the given user, creating the role if needed.
+func (s *Storage) AssignRole(ctx context.Context, userID int64, role string) error {
+	const op = "storage.sqlite.AssignRole"
+
+	return s.withRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO roles(name) VALUES(?) ON CONFLICT DO NOTHING", role); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO user_roles(user_id, role_id) SELECT ?, id FROM roles WHERE name = ? ON CONFLICT DO NOTHING",
+			userID, role,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// RevokeRole removes the role from the given user.
+func (s *Storage) RevokeRole(ctx context.Context, userID int64, role string) error {
+	const op = "storage.sqlite.RevokeRole"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"DELETE FROM user_roles WHERE user_id = ? AND role_id = (SELECT id FROM roles WHERE name = ?)",
+			userID, role,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// UserRoles returns the names of the roles assigned to the given user.
+func (s *Storage) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	const op = "storage.sqlite.UserRoles"
+
+	return withRetryValue(ctx, s, func() ([]string, error) {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id = r.id WHERE ur.user_id = ? ORDER BY r.name",
+			userID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer rows.Close()
+
+		var roles []string
+
+		for rows.Next() {
+			var role string
+			if err := rows.Scan(&role); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			roles = append(roles, role)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return roles, nil
+	})
+}
+
+// GrantScope grants the scope to every user with the role, creating the role
+// if needed.
+func (s *Storage) GrantScope(ctx context.Context, role, scope string) error {
+	const op = "storage.sqlite.GrantScope"
+
+	return s.withRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO roles(name) VALUES(?) ON CONFLICT DO NOTHING", role); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO role_scopes(role_id, scope) SELECT id, ? FROM roles WHERE name = ? ON CONFLICT DO NOTHING",
+			scope, role,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// RevokeScope removes the scope from the role.
+func (s *Storage) RevokeScope(ctx context.Context, role, scope string) error {
+	const op = "storage.sqlite.RevokeScope"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"DELETE FROM role_scopes WHERE role_id = (SELECT id FROM roles WHERE name = ?) AND scope = ?",
+			role, scope,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// UserScopes returns the scopes granted to the given user through their
+// roles, each once.
+func (s *Storage) UserScopes(ctx context.Context, userID int64) ([]string, error) {
+	const op = "storage.sqlite.UserScopes"
+
+	return withRetryValue(ctx, s, func() ([]string, error) {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT DISTINCT rs.scope FROM role_scopes rs JOIN user_roles ur ON ur.role_id = rs.role_id WHERE ur.user_id = ? ORDER BY rs.scope",
+			userID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer rows.Close()
+
+		var scopes []string
+
+		for rows.Next() {
+			var scope string
+			if err := rows.Scan(&scope); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			scopes = append(scopes, scope)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return scopes, nil
+	})
+}
+
+// UpdateAppClaims replaces the static claims merged into the app's tokens.
+func (s *Storage) UpdateAppClaims(ctx context.Context, appID int, claims map[string]any) error {
+	const op = "storage.sqlite.UpdateAppClaims"
+
+	return s.withRetry(ctx, func() error {
+		encoded, err := json.Marshal(claims)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		res, err := s.db.ExecContext(ctx, "UPDATE apps SET claims = ? WHERE id = ?", string(encoded), appID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return nil
+	})
+}
+
+// SaveEmailVerification stores the hash of an issued email verification token.
+func (s *Storage) SaveEmailVerification(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) error {
+	const op = "storage.sqlite.SaveEmailVerification"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO email_verifications(user_id, token_hash, expires_at) VALUES(?, ?, ?)",
+			userID, tokenHash, expiresAt.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// MarkVerificationSent records sentAt as the time a verification email was
+// last sent to the user, unless one was sent after since, and reports whether
+// it did. The check and the update are a single statement, so concurrent
+// callers can't both pass it.
+func (s *Storage) MarkVerificationSent(ctx context.Context, userID int64, sentAt, since time.Time) (bool, error) {
+	const op = "storage.sqlite.MarkVerificationSent"
+
+	return withRetryValue(ctx, s, func() (bool, error) {
+		res, err := s.db.ExecContext(ctx,
+			"UPDATE users SET verification_sent_at = ? WHERE id = ? AND deleted_at IS NULL AND (verification_sent_at IS NULL OR verification_sent_at <= ?)",
+			sentAt.UTC(), userID, since.UTC(),
+		)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return n > 0, nil
+	})
+}
+
+// VerifyEmail marks an unused, unexpired email verification token as used and
+// flags the user it was issued to as verified.
+func (s *Storage) VerifyEmail(ctx context.Context, tokenHash []byte, now time.Time) (int64, error) {
+	const op = "storage.sqlite.VerifyEmail"
+
+	return withRetryValue(ctx, s, func() (int64, error) {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		row := tx.QueryRowContext(ctx,
+			"UPDATE email_verifications SET used = TRUE WHERE token_hash = ? AND NOT used AND expires_at > ? RETURNING user_id",
+			tokenHash, now.UTC(),
+		)
+
+		var userID int64
+		if err := row.Scan(&userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, fmt.Errorf("%s: %w", op, storage.ErrInvalidVerification)
+			}
+
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET is_verified = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = ?", userID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return userID, nil
+	})
+}
+
+// DeleteUser soft-deletes the user by setting deleted_at, which hides them
+// from User and UserByID.
+func (s *Storage) DeleteUser(ctx context.Context, userID int64, deletedAt time.Time) error {
+	const op = "storage.sqlite.DeleteUser"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx,
+			"UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL",
+			deletedAt.UTC(), userID,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil
+	})
+}
+
+// EraseUser permanently removes the user, including soft-deleted ones, along
+// with every row referencing them.
+func (s *Storage) EraseUser(ctx context.Context, userID int64) error {
+	const op = "storage.sqlite.EraseUser"
+
+	return s.withRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		var email string
+		if err := tx.QueryRowContext(ctx, "SELECT email FROM users WHERE id = ?", userID).Scan(&email); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+			}
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		// SQLite doesn't enforce foreign keys unless asked to, so dependent rows
+		// are removed explicitly rather than relying on ON DELETE CASCADE.
+		for _, query := range []string{
+			"DELETE FROM refresh_tokens WHERE user_id = ?",
+			"DELETE FROM password_resets WHERE user_id = ?",
+			"DELETE FROM email_verifications WHERE user_id = ?",
+			"DELETE FROM user_roles WHERE user_id = ?",
+			"DELETE FROM sessions WHERE user_id = ?",
+			"DELETE FROM users WHERE id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM login_attempts WHERE email = ?", email); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// SaveApp saves an app to the database and returns its ID.
+func (s *Storage) SaveApp(ctx context.Context, name, secret string) (int, error) {
+	const op = "storage.sqlite.SaveApp"
+
+	return withRetryValue(ctx, s, func() (int, error) {
+		res, err := s.db.ExecContext(ctx, "INSERT INTO apps(name, secret) VALUES(?, ?)", name, secret)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return 0, fmt.Errorf("%s: %w", op, storage.ErrAppExists)
+			}
+
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return int(id), nil
+	})
+}
+
+// UpdateAppSecret replaces the secret the app's tokens are signed with and
+// forgets its previous secrets.
+func (s *Storage) UpdateAppSecret(ctx context.Context, appID int, secret string) error {
+	const op = "storage.sqlite.UpdateAppSecret"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE apps SET secret = ?, previous_secrets = NULL WHERE id = ?", secret, appID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return nil
+	})
+}
+
+// AddAppSecret makes secret the app's secret and keeps the current one as
+// the newest of its previous secrets, of which at most keep are kept.
+func (s *Storage) AddAppSecret(ctx context.Context, appID int, secret string, keep int) error {
+	const op = "storage.sqlite.AddAppSecret"
+
+	return s.withRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		var (
+			current         string
+			encoded         []byte
+			previousSecrets []string
+		)
+
+		if err := tx.QueryRowContext(ctx, "SELECT secret, previous_secrets FROM apps WHERE id = ?", appID).Scan(&current, &encoded); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+			}
+
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if encoded != nil {
+			if err := json.Unmarshal(encoded, &previousSecrets); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		previousSecrets = append([]string{current}, previousSecrets...)
+		previousSecrets = previousSecrets[:min(len(previousSecrets), keep)]
+
+		encoded, err = json.Marshal(previousSecrets)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE apps SET secret = ?, previous_secrets = ? WHERE id = ?", secret, string(encoded), appID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// DropPreviousAppSecrets forgets the app's previous secrets.
+func (s *Storage) DropPreviousAppSecrets(ctx context.Context, appID int) error {
+	const op = "storage.sqlite.DropPreviousAppSecrets"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE apps SET previous_secrets = NULL WHERE id = ?", appID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return nil
+	})
+}
+
+// DeleteApp removes the app with the given ID.
+func (s *Storage) DeleteApp(ctx context.Context, appID int) error {
+	const op = "storage.sqlite.DeleteApp"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "DELETE FROM apps WHERE id = ?", appID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return nil
+	})
+}
+
+// likeEscaper escapes the LIKE wildcards in user-supplied search strings.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ListUsers returns a page of users matching the filter, ordered by creation
+// time, along with the total number of matching users. Deleted users are
+// skipped and password hashes are not loaded.
+func (s *Storage) ListUsers(ctx context.Context, filter models.UserFilter, limit, offset int) ([]models.User, int64, error) {
+	const op = "storage.sqlite.ListUsers"
+
+	var (
+		users []models.User
+		total int64
+	)
+
+	err := s.withRetry(ctx, func() error {
+		where := "deleted_at IS NULL AND email LIKE ? ESCAPE '\\'"
+		pattern := "%" + likeEscaper.Replace(filter.EmailContains) + "%"
+
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE "+where, pattern).Scan(&total); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		order := "ASC"
+		if filter.NewestFirst {
+			order = "DESC"
+		}
+
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id, email, COALESCE(username, ''), is_verified, is_active, created_at, updated_at FROM users WHERE "+where+
+				" ORDER BY created_at "+order+", id "+order+" LIMIT ? OFFSET ?",
+			pattern, limit, offset,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer rows.Close()
+
+		users = nil
+		for rows.Next() {
+			var (
+				user      models.User
+				createdAt sql.NullTime
+				updatedAt sql.NullTime
+			)
+
+			if err := rows.Scan(&user.ID, &user.Email, &user.Username, &user.IsVerified, &user.IsActive, &createdAt, &updatedAt); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			user.CreatedAt = createdAt.Time
+			user.UpdatedAt = updatedAt.Time
+			users = append(users, user)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// Ping checks that the database is reachable.
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.sqlite.Ping"
+
+	if err := s.sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w: %w", op, storage.ErrUnavailable, err)
+	}
+
+	return nil
+}
+
+// UpdateAppTokenTTL sets the TTL of the app's access tokens, stored in
+// seconds. A zero ttl clears it.
+func (s *Storage) UpdateAppTokenTTL(ctx context.Context, appID int, ttl time.Duration) error {
+	const op = "storage.sqlite.UpdateAppTokenTTL"
+
+	return s.withRetry(ctx, func() error {
+		var seconds sql.NullInt64
+		if ttl > 0 {
+			seconds = sql.NullInt64{Int64: int64(ttl / time.Second), Valid: true}
+		}
+
+		res, err := s.db.ExecContext(ctx, "UPDATE apps SET token_ttl = ? WHERE id = ?", seconds, appID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return nil
+	})
+}
+
+// UpdateAppSigningAlg sets the algorithm the app's tokens are signed with.
+// An empty alg is stored as NULL.
+func (s *Storage) UpdateAppSigningAlg(ctx context.Context, appID int, alg string) error {
+	const op = "storage.sqlite.UpdateAppSigningAlg"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE apps SET signing_alg = ? WHERE id = ?", nullString(alg), appID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return nil
+	})
+}
+
+// UpdateAppTokenBinding sets whether the app's tokens are bound to client
+// fingerprints.
+func (s *Storage) UpdateAppTokenBinding(ctx context.Context, appID int, bind bool) error {
+	const op = "storage.sqlite.UpdateAppTokenBinding"
+
+	return s.withRetry(ctx, func() error {
+		res, err := s.db.ExecContext(ctx, "UPDATE apps SET bind_tokens = ? WHERE id = ?", bind, appID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return nil
+	})
+}
+
+// ImportUsers inserts users in a single transaction. It returns one error per
+// record, nil for imported users and ErrUserExists for duplicate emails, and
+// a non-nil error if the batch as a whole failed, in which case nothing was
+// imported.
+func (s *Storage) ImportUsers(ctx context.Context, users []models.UserImport) ([]error, error) {
+	const op = "storage.sqlite.ImportUsers"
+
+	return withRetryValue(ctx, s, func() ([]error, error) {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		stmt, err := tx.PrepareContext(ctx,
+			"INSERT INTO users(email, pass_hash, is_verified, created_at, updated_at) VALUES(?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) ON CONFLICT (email) DO NOTHING",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer stmt.Close()
+
+		results := make([]error, len(users))
+
+		for i, user := range users {
+			res, err := stmt.ExecContext(ctx, user.Email, user.PassHash, user.IsVerified)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			if n == 0 {
+				results[i] = fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return results, nil
+	})
+}
+
+// UserByUsername returns the user with the given username, skipping deleted
+// users.
+func (s *Storage) UserByUsername(ctx context.Context, username string) (models.User, error) {
+	const op = "storage.sqlite.UserByUsername"
+
+	return withRetryValue(ctx, s, func() (models.User, error) {
+		row := s.db.QueryRowContext(ctx, "SELECT id, email, username, pass_hash, is_verified, is_active, must_change_password FROM users WHERE username = ? AND deleted_at IS NULL", username)
+
+		var user models.User
+		if err := row.Scan(&user.ID, &user.Email, &user.Username, &user.PassHash, &user.IsVerified, &user.IsActive, &user.MustChangePassword); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+			}
+
+			return models.User{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return user, nil
+	})
+}
+
+// nullString maps an empty string to NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// isUniqueViolation reports whether err is a UNIQUE or PRIMARY KEY
+// constraint violation, going by the extended result code rather than the
+// message.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// isUsernameConflict reports whether a unique constraint violation is on the
+// username column rather than the email. SQLite only names the offending
+// columns in the message, as in "UNIQUE constraint failed: users.username".
+func isUsernameConflict(err error) bool {
+	return strings.Contains(err.Error(), "users.username")
+}
+
+// UserExists reports whether a user with the given email exists, ignoring
+// deleted users.
+func (s *Storage) UserExists(ctx context.Context, email string) (bool, error) {
+	const op = "storage.sqlite.UserExists"
+
+	return withRetryValue(ctx, s, func() (bool, error) {
+		var exists bool
+		if err := s.db.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM users WHERE email = ? AND deleted_at IS NULL)", email,
+		).Scan(&exists); err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return exists, nil
+	})
+}
+
+// Close checkpoints the write-ahead log into the database file and closes the
+// database handle.
+func (s *Storage) Close() error {
+	const op = "storage.sqlite.Close"
+
+	if s.inTx {
+		return fmt.Errorf("%s: storage is bound to a transaction", op)
+	}
+
+	if _, err := s.sqlDB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		_ = s.sqlDB.Close()
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.sqlDB.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveAuthEvent appends an event to the audit log. A zero user ID is stored
+// as NULL.
+func (s *Storage) SaveAuthEvent(ctx context.Context, event models.AuthEvent) error {
+	const op = "storage.sqlite.SaveAuthEvent"
+
+	return s.withRetry(ctx, func() error {
+		userID := sql.NullInt64{Int64: event.UserID, Valid: event.UserID != 0}
+		actorID := sql.NullInt64{Int64: event.ActorID, Valid: event.ActorID != 0}
+
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO audit_log(user_id, actor_id, event, reason, request_id, ip, created_at) VALUES(?, ?, ?, ?, ?, ?, ?)",
+			userID, actorID, event.Type, event.Reason, event.RequestID, event.IP, event.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// AuthEvents returns up to limit of the user's most recent audit log events,
+// newest first.
+func (s *Storage) AuthEvents(ctx context.Context, userID int64, limit int) ([]models.AuthEvent, error) {
+	const op = "storage.sqlite.AuthEvents"
+
+	return withRetryValue(ctx, s, func() ([]models.AuthEvent, error) {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id, user_id, COALESCE(actor_id, 0), event, reason, request_id, ip, created_at FROM audit_log WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ?",
+			userID, limit,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer rows.Close()
+
+		var events []models.AuthEvent
+		for rows.Next() {
+			var event models.AuthEvent
+			if err := rows.Scan(&event.ID, &event.UserID, &event.ActorID, &event.Type, &event.Reason, &event.RequestID, &event.IP, &event.CreatedAt); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			events = append(events, event)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return events, nil
+	})
+}
+
+// SaveOutboxEvent appends an event to the outbox.
+func (s *Storage) SaveOutboxEvent(ctx context.Context, event models.OutboxEvent) error {
+	const op = "storage.sqlite.SaveOutboxEvent"
+
+	return s.withRetry(ctx, func() error {
+		if err := saveOutboxEvent(ctx, s.db, event); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// PendingOutboxEvents returns up to limit of the events not yet marked as
+// sent, oldest first.
+func (s *Storage) PendingOutboxEvents(ctx context.Context, limit int) ([]models.OutboxEvent, error) {
+	const op = "storage.sqlite.PendingOutboxEvents"
+
+	return withRetryValue(ctx, s, func() ([]models.OutboxEvent, error) {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id, event, user_id, payload, created_at FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT ?",
+			limit,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer rows.Close()
+
+		var events []models.OutboxEvent
+		for rows.Next() {
+			var event models.OutboxEvent
+			if err := rows.Scan(&event.ID, &event.Type, &event.UserID, &event.Payload, &event.CreatedAt); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			events = append(events, event)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return events, nil
+	})
+}
+
+// MarkOutboxEventSent records that the event has been published. Marking an
+// event again is a no-op.
+func (s *Storage) MarkOutboxEventSent(ctx context.Context, id int64, sentAt time.Time) error {
+	const op = "storage.sqlite.MarkOutboxEventSent"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"UPDATE outbox SET sent_at = ? WHERE id = ? AND sent_at IS NULL",
+			sentAt.UTC(), id,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// DeleteSentOutboxEvents purges events sent before the given time and
+// returns how many were deleted.
+func (s *Storage) DeleteSentOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.sqlite.DeleteSentOutboxEvents"
+
+	return withRetryValue(ctx, s, func() (int64, error) {
+		res, err := s.db.ExecContext(ctx, "DELETE FROM outbox WHERE sent_at < ?", before.UTC())
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return n, nil
+	})
+}
+
+// assignRoles grants the roles to the user through db, creating those that
+// don't exist.
+func assignRoles(ctx context.Context, db storage.DB, userID int64, roles []string) error {
+	for _, role := range roles {
+		if _, err := db.ExecContext(ctx, "INSERT INTO roles(name) VALUES(?) ON CONFLICT DO NOTHING", role); err != nil {
+			return err
+		}
+
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO user_roles(user_id, role_id) SELECT ?, id FROM roles WHERE name = ? ON CONFLICT DO NOTHING",
+			userID, role,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveOutboxEvent inserts the event through db, which is the transaction of
+// the change the event reports, if there is one.
+func saveOutboxEvent(ctx context.Context, db storage.DB, event models.OutboxEvent) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO outbox(event, user_id, payload, created_at) VALUES(?, ?, ?, ?)",
+		event.Type, event.UserID, string(event.Payload), event.CreatedAt.UTC(),
+	)
+
+	return err
+}
+
+// SaveSession stores a new session.
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "storage.sqlite.SaveSession"
+
+	return s.withRetry(ctx, func() error {
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO sessions(id, user_id, app_id, user_agent, ip, created_at, last_seen_at) VALUES(?, ?, ?, ?, ?, ?, ?)",
+			session.ID, session.UserID, session.AppID, session.UserAgent, session.IP, session.CreatedAt.UTC(), session.LastSeenAt.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// Session returns the session with the given ID.
+func (s *Storage) Session(ctx context.Context, sessionID string) (models.Session, error) {
+	const op = "storage.sqlite.Session"
+
+	return withRetryValue(ctx, s, func() (models.Session, error) {
+		row := s.db.QueryRowContext(ctx,
+			"SELECT id, user_id, app_id, user_agent, ip, created_at, last_seen_at, revoked FROM sessions WHERE id = ?",
+			sessionID,
+		)
+
+		var session models.Session
+		if err := row.Scan(
+			&session.ID, &session.UserID, &session.AppID, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastSeenAt, &session.Revoked,
+		); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return models.Session{}, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+			}
+
+			return models.Session{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return session, nil
+	})
+}
+
+// TouchSession updates the time the session was last used.
+func (s *Storage) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error {
+	const op = "storage.sqlite.TouchSession"
+
+	return s.withRetry(ctx, func() error {
+		if _, err := s.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ?", seenAt.UTC(), sessionID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
+
+// ListSessions returns the user's sessions that haven't been revoked, most
+// recently used first.
+func (s *Storage) ListSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "storage.sqlite.ListSessions"
+
+	return withRetryValue(ctx, s, func() ([]models.Session, error) {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id, user_id, app_id, user_agent, ip, created_at, last_seen_at, revoked FROM sessions WHERE user_id = ? AND NOT revoked ORDER BY last_seen_at DESC",
+			userID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		defer rows.Close()
+
+		var sessions []models.Session
+		for rows.Next() {
+			var session models.Session
+			if err := rows.Scan(
+				&session.ID, &session.UserID, &session.AppID, &session.UserAgent, &session.IP,
+				&session.CreatedAt, &session.LastSeenAt, &session.Revoked,
+			); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+
+			sessions = append(sessions, session)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return sessions, nil
+	})
+}
+
+// RevokeSession marks the session and the refresh tokens issued for it as
+// revoked.
+func (s *Storage) RevokeSession(ctx context.Context, sessionID string) error {
+	const op = "storage.sqlite.RevokeSession"
+
+	return s.withRetry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		res, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked = TRUE WHERE id = ?", sessionID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE session_id = ?", sessionID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	})
+}
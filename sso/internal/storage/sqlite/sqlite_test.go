@@ -0,0 +1,72 @@
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sso/internal/migrator"
+	"sso/internal/storage"
+	"sso/internal/storage/sqlite"
+	"testing"
+	"time"
+)
+
+func newTestStorage(t *testing.T) *sqlite.Storage {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sso.db")
+
+	if err := migrator.RunMigrations(migrator.DriverSQLite, path, "../../../migrations", "", sqlite.Options{}, migrator.Up); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	s, err := sqlite.New(path, storage.PoolConfig{}, sqlite.Options{}, storage.RetryPolicy{})
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+func TestSaveUserConflicts(t *testing.T) {
+	ctx := context.Background()
+	passHash := []byte("hash")
+
+	tests := []struct {
+		name     string
+		email    string
+		username string
+		// deleteFirst soft-deletes the existing user before saving.
+		deleteFirst bool
+		wantErr     error
+	}{
+		{name: "new user", email: "other@example.com", username: "other"},
+		{name: "duplicate email", email: "user@example.com", wantErr: storage.ErrUserExists},
+		{name: "duplicate email of a deleted user", email: "user@example.com", deleteFirst: true, wantErr: storage.ErrUserExists},
+		{name: "duplicate username", email: "other@example.com", username: "user", wantErr: storage.ErrUsernameTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+
+			userID, err := s.SaveUser(ctx, "user@example.com", "user", passHash, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("failed to save user: %v", err)
+			}
+
+			if tt.deleteFirst {
+				if err := s.DeleteUser(ctx, userID, time.Now()); err != nil {
+					t.Fatalf("failed to delete user: %v", err)
+				}
+			}
+
+			_, err = s.SaveUser(ctx, tt.email, tt.username, passHash, nil, nil, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SaveUser() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
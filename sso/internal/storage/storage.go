@@ -2,9 +2,18 @@ package storage
 
 import "errors"
 
+// Errors returned by the storage backends. The auth service exposes them as
+// its own errors, callers outside of it should use those.
 var (
-	ErrUserExists         = errors.New("user already exists")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrAppNotFound        = errors.New("app not found")
-	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserExists           = errors.New("user already exists")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrAppExists            = errors.New("app already exists")
+	ErrAppNotFound          = errors.New("app not found")
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrInvalidResetToken    = errors.New("invalid or expired password reset token")
+	ErrInvalidVerification  = errors.New("invalid or expired email verification token")
+	ErrInvalidMagicLink     = errors.New("invalid or expired magic link")
+	ErrUnavailable          = errors.New("storage is unavailable")
+	ErrUsernameTaken        = errors.New("username is taken")
+	ErrSessionNotFound      = errors.New("session not found")
 )
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WithQueryTimeout wraps db so that every statement runs under a deadline
+// of timeout, unless its context already has an earlier one, and a stalled
+// connection can't block the caller forever. Transactions begun through the
+// wrapper aren't bounded as a whole, only their statements are. A
+// non-positive timeout returns db as is.
+func WithQueryTimeout(db DB, timeout time.Duration) DB {
+	if timeout <= 0 {
+		return db
+	}
+
+	return &timeoutDB{DB: db, timeout: timeout}
+}
+
+type timeoutDB struct {
+	DB
+	timeout time.Duration
+}
+
+func (d *timeoutDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.DB.ExecContext(ctx, query, args...)
+}
+
+// The rows returned by QueryContext and QueryRowContext are read after the
+// call returns, so their context can't be cancelled then. Its timer is
+// released once the deadline passes instead.
+
+func (d *timeoutDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	context.AfterFunc(ctx, cancel)
+
+	return d.DB.QueryContext(ctx, query, args...)
+}
+
+func (d *timeoutDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, cancel := d.withTimeout(ctx)
+	context.AfterFunc(ctx, cancel)
+
+	return d.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (d *timeoutDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.DB.PrepareContext(ctx, query)
+}
+
+func (d *timeoutDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &timeoutTx{timeoutDB: &timeoutDB{DB: tx, timeout: d.timeout}, tx: tx}, nil
+}
+
+// withTimeout returns ctx bounded by the timeout, or ctx itself if its
+// deadline comes sooner.
+func (d *timeoutDB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d.timeout {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, d.timeout)
+}
+
+// timeoutTx is a Tx whose statements, and those of its savepoints, are
+// bounded by timeoutDB.
+type timeoutTx struct {
+	*timeoutDB
+	tx Tx
+}
+
+func (t *timeoutTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *timeoutTx) Rollback() error {
+	return t.tx.Rollback()
+}
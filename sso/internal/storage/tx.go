@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DB is what the SQL storages run their queries through: the database itself
+// or, for a storage bound to a transaction, that transaction.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	// BeginTx begins a transaction or, when called on a transaction, a
+	// savepoint within it, which keeps nested calls on the same connection.
+	// opts only apply to the outermost transaction.
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+}
+
+// Tx is a transaction or savepoint begun by DB.BeginTx. Like *sql.Tx,
+// Rollback after Commit is a no-op returning sql.ErrTxDone.
+type Tx interface {
+	DB
+	Commit() error
+	Rollback() error
+}
+
+// NewDB wraps db as a DB.
+func NewDB(db *sql.DB) DB {
+	return sqlDB{db}
+}
+
+type sqlDB struct {
+	*sql.DB
+}
+
+func (d sqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlTx{Tx: tx}, nil
+}
+
+type sqlTx struct {
+	*sql.Tx
+	// savepoints counts the savepoints begun so far, to name them uniquely.
+	savepoints int
+}
+
+func (t *sqlTx) BeginTx(ctx context.Context, _ *sql.TxOptions) (Tx, error) {
+	return t.savepoint(ctx)
+}
+
+func (t *sqlTx) savepoint(ctx context.Context) (*savepoint, error) {
+	t.savepoints++
+	name := fmt.Sprintf("sp_%d", t.savepoints)
+
+	if _, err := t.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return nil, err
+	}
+
+	return &savepoint{sqlTx: t, ctx: ctx, name: name}, nil
+}
+
+// savepoint is a Tx nested in a transaction. Rolling it back only undoes
+// what was done since it began and leaves the transaction usable.
+type savepoint struct {
+	*sqlTx
+	ctx  context.Context
+	name string
+	done bool
+}
+
+func (s *savepoint) BeginTx(ctx context.Context, _ *sql.TxOptions) (Tx, error) {
+	return s.sqlTx.savepoint(ctx)
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+
+	s.done = true
+
+	_, err := s.ExecContext(s.ctx, "RELEASE SAVEPOINT "+s.name)
+
+	return err
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+
+	s.done = true
+
+	if _, err := s.ExecContext(s.ctx, "ROLLBACK TO SAVEPOINT "+s.name); err != nil {
+		return err
+	}
+
+	_, err := s.ExecContext(s.ctx, "RELEASE SAVEPOINT "+s.name)
+
+	return err
+}
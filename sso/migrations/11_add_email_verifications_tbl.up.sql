@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN is_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users
+SET is_verified = TRUE;
+
+CREATE TABLE IF NOT EXISTS email_verifications
+(
+    id         INTEGER PRIMARY KEY,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash BLOB      NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used       BOOLEAN   NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN created_at TIMESTAMP;
+
+UPDATE users
+SET created_at = CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at);
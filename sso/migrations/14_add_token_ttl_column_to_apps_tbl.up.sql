@@ -0,0 +1,2 @@
+ALTER TABLE apps
+    ADD COLUMN token_ttl INTEGER;
\ No newline at end of file
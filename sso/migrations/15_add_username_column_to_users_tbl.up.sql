@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN username TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
\ No newline at end of file
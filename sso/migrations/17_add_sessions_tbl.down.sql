@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens DROP COLUMN session_id;
+
+DROP TABLE IF EXISTS sessions;
\ No newline at end of file
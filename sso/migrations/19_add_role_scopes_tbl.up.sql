@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS role_scopes
+(
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    scope   TEXT    NOT NULL,
+    PRIMARY KEY (role_id, scope)
+);
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN updated_at TIMESTAMP;
+
+UPDATE users
+SET updated_at = created_at;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN verification_sent_at TIMESTAMP;
\ No newline at end of file
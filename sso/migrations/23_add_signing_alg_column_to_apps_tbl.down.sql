@@ -0,0 +1 @@
+ALTER TABLE apps DROP COLUMN signing_alg;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE apps
+    ADD COLUMN signing_alg TEXT;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE audit_log
+    ADD COLUMN actor_id INTEGER;
\ No newline at end of file
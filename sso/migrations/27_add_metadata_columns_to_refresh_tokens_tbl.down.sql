@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens DROP COLUMN device;
+ALTER TABLE refresh_tokens DROP COLUMN last_used_at;
+ALTER TABLE refresh_tokens DROP COLUMN created_at;
\ No newline at end of file
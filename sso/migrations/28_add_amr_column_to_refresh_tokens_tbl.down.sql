@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens DROP COLUMN amr;
\ No newline at end of file
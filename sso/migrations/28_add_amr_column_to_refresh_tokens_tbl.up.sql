@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN amr TEXT NOT NULL DEFAULT '';
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id         INTEGER PRIMARY KEY,
+    event      TEXT      NOT NULL,
+    user_id    INTEGER   NOT NULL,
+    payload    TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    sent_at    TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (id) WHERE sent_at IS NULL;
\ No newline at end of file
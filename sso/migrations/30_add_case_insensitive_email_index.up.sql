@@ -0,0 +1,10 @@
+-- Emails are stored lowercased, but users registered before that may only
+-- differ in case. Those are lowercased first where that's unambiguous, as in
+-- migration 18. Any left make this migration fail; merge or delete them by
+-- hand, run the migrator with -force 29 and migrate again. Find them with:
+--   SELECT LOWER(email), COUNT(*) FROM users GROUP BY LOWER(email) HAVING COUNT(*) > 1;
+UPDATE users
+SET email = LOWER(TRIM(email))
+WHERE email <> LOWER(TRIM(email))
+  AND (SELECT COUNT(*) FROM users u WHERE LOWER(TRIM(u.email)) = LOWER(TRIM(users.email))) = 1;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_nocase ON users (email COLLATE NOCASE);
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE apps
+    ADD COLUMN bind_tokens BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE refresh_tokens
+    ADD COLUMN fingerprint TEXT NOT NULL DEFAULT '';
\ No newline at end of file
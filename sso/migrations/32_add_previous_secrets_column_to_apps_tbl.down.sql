@@ -0,0 +1 @@
+ALTER TABLE apps DROP COLUMN previous_secrets;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN app_id INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
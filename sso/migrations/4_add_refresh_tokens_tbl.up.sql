@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id         INTEGER PRIMARY KEY,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash BLOB      NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked    BOOLEAN   NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
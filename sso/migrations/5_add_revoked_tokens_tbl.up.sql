@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti        TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
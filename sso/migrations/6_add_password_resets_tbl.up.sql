@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS password_resets
+(
+    id         INTEGER PRIMARY KEY,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash BLOB      NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used       BOOLEAN   NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    email        TEXT PRIMARY KEY,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP
+);
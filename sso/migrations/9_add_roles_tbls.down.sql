@@ -0,0 +1,9 @@
+UPDATE users
+SET is_admin = EXISTS(SELECT 1
+                      FROM user_roles ur
+                               JOIN roles r ON r.id = ur.role_id
+                      WHERE ur.user_id = users.id
+                        AND r.name = 'admin');
+
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1 @@
+ALTER TABLE apps DROP COLUMN claims;
\ No newline at end of file
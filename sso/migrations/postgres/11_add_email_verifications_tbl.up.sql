@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN is_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users
+SET is_verified = TRUE;
+
+CREATE TABLE IF NOT EXISTS email_verifications
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash BYTEA       NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE
+);
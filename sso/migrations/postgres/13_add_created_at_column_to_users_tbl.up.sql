@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at);
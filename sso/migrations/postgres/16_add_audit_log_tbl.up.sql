@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT,
+    event      TEXT        NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT '',
+    request_id TEXT        NOT NULL DEFAULT '',
+    ip         TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id, created_at);
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           TEXT PRIMARY KEY,
+    user_id      BIGINT      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id       INTEGER     NOT NULL,
+    user_agent   TEXT        NOT NULL DEFAULT '',
+    ip           TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    revoked      BOOLEAN     NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN session_id TEXT;
\ No newline at end of file
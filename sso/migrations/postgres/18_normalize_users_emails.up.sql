@@ -0,0 +1,4 @@
+UPDATE users
+SET email = LOWER(TRIM(email))
+WHERE email <> LOWER(TRIM(email))
+  AND (SELECT COUNT(*) FROM users u WHERE LOWER(TRIM(u.email)) = LOWER(TRIM(users.email))) = 1;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS role_scopes;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN created_at TIMESTAMPTZ;
+ALTER TABLE refresh_tokens
+    ADD COLUMN last_used_at TIMESTAMPTZ;
+ALTER TABLE refresh_tokens
+    ADD COLUMN device TEXT NOT NULL DEFAULT '';
\ No newline at end of file
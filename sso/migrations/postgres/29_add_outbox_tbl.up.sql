@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id         BIGSERIAL PRIMARY KEY,
+    event      TEXT        NOT NULL,
+    user_id    BIGINT      NOT NULL,
+    payload    TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    sent_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (id) WHERE sent_at IS NULL;
\ No newline at end of file
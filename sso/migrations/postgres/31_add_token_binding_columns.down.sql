@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens DROP COLUMN fingerprint;
+ALTER TABLE apps DROP COLUMN bind_tokens;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE apps
+    ADD COLUMN previous_secrets JSONB;
\ No newline at end of file
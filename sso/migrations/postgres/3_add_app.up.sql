@@ -0,0 +1,5 @@
+INSERT INTO apps (id, name, secret)
+VALUES (1, 'test', 'test-secret')
+ON CONFLICT DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('apps', 'id'), (SELECT MAX(id) FROM apps));
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN totp_secret;
\ No newline at end of file